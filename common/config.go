@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"time"
+	"yc-backend/models"
 
 	"github.com/gookit/config/v2"
 	"github.com/gookit/config/v2/yaml"
@@ -51,6 +53,29 @@ type Config struct {
 
 	AllowedCorsOrigin []string `config:"allowedCorsOrigin"`
 
+	Payroll struct {
+		Concurrency       int `config:"concurrency"`
+		SchedulerInterval int `config:"schedulerInterval"` // seconds
+	}
+
+	Reconciliation struct {
+		Interval   int `config:"interval"`   // seconds
+		StaleAfter int `config:"staleAfter"` // seconds
+	}
+
+	Retry struct {
+		MaxAttempts      int      `config:"maxAttempts"`
+		Backoff          int      `config:"backoff"` // seconds, doubled after every attempt
+		TransientReasons []string `config:"transientReasons"`
+	}
+
+	// SpendingLimits are the default limits of a business without its own
+	// spending limit policy; zero amounts mean no limit.
+	SpendingLimits struct {
+		Business models.SpendingLimits `config:"business"`
+		Employee models.SpendingLimits `config:"employee"`
+	}
+
 	SmtpCredentials struct {
 		BaseUrl       string `config:"baseUrl"`
 		ProjectSecret string `config:"projectSecret"`
@@ -106,6 +131,16 @@ func LoadConfiguration(cfgEnvSetting ConfEnvSetting) (*Config, error) {
 	return cfg, nil
 }
 
+// IsAdmin reports whether the email is one of the configured admin emails.
+func (c *Config) IsAdmin(email string) bool {
+	for _, admin := range strings.Split(c.AppCredentials.AdminEmails, ",") {
+		if admin = strings.TrimSpace(admin); admin != "" && strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
+
 func GetConfig() *Config {
 	return cfg
 }
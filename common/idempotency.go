@@ -0,0 +1,194 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+	"yc-backend/models"
+	"yc-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	idempotencyStorageTimeout = 5 * time.Second
+	idempotentWriteContextKey = "__yc_idempotent_write"
+)
+
+// errRecordedRequestFailed is stored for a request that panicked after it wrote
+// something a retry must not repeat.
+var errRecordedRequestFailed = errors.New("the request failed after it was recorded, check its outcome before sending it again")
+
+// idempotentWrite tracks whether the handler wrote state a retry would repeat.
+type idempotentWrite struct {
+	written bool
+}
+
+// RecordIdempotentWrite marks the request behind ctx as having written state,
+// such as a disbursement, that sending it again would duplicate. Its response
+// is then kept for its Idempotency-Key even when it is a server error. It does
+// nothing outside an idempotent request.
+func RecordIdempotentWrite(ctx context.Context) {
+	if write, ok := ctx.Value(idempotentWriteContextKey).(*idempotentWrite); ok {
+		write.written = true
+	}
+}
+
+type idempotentResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotentResponseWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotentResponseWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotent makes a route safe to retry. When the Idempotency-Key header is set,
+// the first response for that key is persisted and replayed for any later request
+// with the same key and body; a different body with the same key is rejected.
+// A handler that panics or answers with a server error releases the key, so the
+// request can be retried, unless it already called RecordIdempotentWrite: that
+// response is kept like any other so a retry cannot act twice. It must run after
+// AuthorizeUser since keys are scoped to the user.
+func Idempotent() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			ctx.Next()
+			return
+		}
+
+		repo := ReposFromCtx(ctx)
+		logger := LoggerFromCtx(ctx)
+		user, ok := ctx.MustGet(UserKey).(*models.User)
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+			return
+		}
+
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse(err))
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+
+		hasher := sha256.New()
+		hasher.Write([]byte(ctx.Request.Method))
+		hasher.Write([]byte(ctx.Request.URL.RequestURI()))
+		hasher.Write(body)
+		requestHash := hex.EncodeToString(hasher.Sum(nil))
+
+		storageCtx, cancel := context.WithTimeout(context.Background(), idempotencyStorageTimeout)
+		defer cancel()
+
+		timeNow := time.Now()
+		record := models.IdempotencyRecord{
+			UserID:      user.ID,
+			Key:         key,
+			Method:      ctx.Request.Method,
+			Path:        ctx.Request.URL.RequestURI(),
+			RequestHash: requestHash,
+			CreatedAt:   &timeNow,
+		}
+		id, err := repo.Idempotency.Create(storageCtx, record)
+		if mongo.IsDuplicateKeyError(err) {
+			replayIdempotentResponse(ctx, storageCtx, user.ID, key, requestHash)
+			return
+		}
+		if err != nil {
+			logger.Errorf("could not store idempotency key [%s]: %v", key, err)
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+			return
+		}
+		recordId, _ := id.(primitive.ObjectID)
+
+		write := &idempotentWrite{}
+		ctx.Set(idempotentWriteContextKey, write)
+		writer := &idempotentResponseWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = writer
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if write.written {
+					response, _ := json.Marshal(utils.ErrorResponse(errRecordedRequestFailed))
+					saveIdempotentResponse(ctx, recordId, key, http.StatusInternalServerError, string(response))
+				} else {
+					releaseIdempotencyKey(ctx, recordId, key)
+				}
+				panic(recovered)
+			}
+		}()
+		ctx.Next()
+
+		if writer.Status() >= http.StatusInternalServerError && !write.written {
+			releaseIdempotencyKey(ctx, recordId, key)
+			return
+		}
+		saveIdempotentResponse(ctx, recordId, key, writer.Status(), writer.body.String())
+	}
+}
+
+// saveIdempotentResponse completes the record of a request with its response.
+func saveIdempotentResponse(ctx *gin.Context, recordId primitive.ObjectID, key string, status int, response string) {
+	completedAt := time.Now()
+	saveCtx, cancel := context.WithTimeout(context.Background(), idempotencyStorageTimeout)
+	defer cancel()
+	if err := ReposFromCtx(ctx).Idempotency.UpdateOneById(saveCtx, recordId, models.IdempotencyRecord{
+		StatusCode:  status,
+		Response:    response,
+		CompletedAt: &completedAt,
+	}); err != nil {
+		LoggerFromCtx(ctx).Errorf("could not store response for idempotency key [%s]: %v", key, err)
+	}
+}
+
+// releaseIdempotencyKey deletes the record of a request that did not complete.
+func releaseIdempotencyKey(ctx *gin.Context, recordId primitive.ObjectID, key string) {
+	releaseCtx, cancel := context.WithTimeout(context.Background(), idempotencyStorageTimeout)
+	defer cancel()
+	if err := ReposFromCtx(ctx).Idempotency.DeleteById(releaseCtx, recordId); err != nil {
+		LoggerFromCtx(ctx).Errorf("could not release idempotency key [%s]: %v", key, err)
+	}
+}
+
+func replayIdempotentResponse(ctx *gin.Context, storageCtx context.Context, userID primitive.ObjectID, key, requestHash string) {
+	existing, err := ReposFromCtx(ctx).Idempotency.FindOne(storageCtx, bson.D{
+		{Key: "user_id", Value: userID},
+		{Key: "key", Value: key},
+	})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
+	}
+	if existing.RequestHash != requestHash {
+		ctx.AbortWithStatusJSON(http.StatusConflict,
+			utils.ErrorResponse(errors.New("Idempotency-Key has already been used with a different request")))
+		return
+	}
+	if existing.CompletedAt == nil {
+		ctx.AbortWithStatusJSON(http.StatusConflict,
+			utils.ErrorResponse(errors.New("a request with this Idempotency-Key is still being processed")))
+		return
+	}
+
+	ctx.Header(IdempotentReplayedHeader, "true")
+	ctx.Data(existing.StatusCode, "application/json; charset=utf-8", []byte(existing.Response))
+	ctx.Abort()
+}
@@ -0,0 +1,120 @@
+package common
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"yc-backend/internals"
+	"yc-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gookit/goutil/testutil/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// serveIdempotent sends a request with an Idempotency-Key to handler behind Idempotent.
+func serveIdempotent(mt *mtest.T, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	cfg := &Config{}
+	cfg.MongoDB.DatabaseName = "yc"
+
+	r := gin.New()
+	r.Use(gin.CustomRecoveryWithWriter(io.Discard, func(ctx *gin.Context, _ any) {
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+	}),
+		AddConfigMiddleware(cfg),
+		AddLoggerMiddleware(internals.GetLogger()),
+		AddReposToMiddleware(mt.Client),
+		func(ctx *gin.Context) { ctx.Set(UserKey, &models.User{ID: primitive.NewObjectID()}) })
+	r.POST("/pay", Idempotent(), handler)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/pay", strings.NewReader(`{}`))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func commandNames(mt *mtest.T) []string {
+	names := []string{}
+	for _, event := range mt.GetAllStartedEvents() {
+		names = append(names, event.CommandName)
+	}
+	return names
+}
+
+func TestIdempotentReleasesKeyWhenHandlerPanics(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("panic", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		w := serveIdempotent(mt, func(ctx *gin.Context) { panic("boom") })
+
+		assert.Eq(t, http.StatusInternalServerError, w.Code)
+		assert.Eq(t, []string{"insert", "delete"}, commandNames(mt))
+	})
+}
+
+func TestIdempotentReleasesKeyOnServerError(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		w := serveIdempotent(mt, func(ctx *gin.Context) { ctx.JSON(http.StatusBadGateway, gin.H{}) })
+
+		assert.Eq(t, http.StatusBadGateway, w.Code)
+		assert.Eq(t, []string{"insert", "delete"}, commandNames(mt))
+	})
+}
+
+func TestIdempotentStoresCompletedResponse(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("ok", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{{Key: "_id", Value: primitive.NewObjectID()}}}))
+
+		w := serveIdempotent(mt, func(ctx *gin.Context) { ctx.JSON(http.StatusOK, gin.H{"paid": true}) })
+
+		assert.Eq(t, http.StatusOK, w.Code)
+		assert.Eq(t, []string{"insert", "findAndModify"}, commandNames(mt))
+	})
+}
+
+func TestIdempotentKeepsKeyOnceTheRequestWrote(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("submission failed after the disbursement was created", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{{Key: "_id", Value: primitive.NewObjectID()}}}))
+
+		w := serveIdempotent(mt, func(ctx *gin.Context) {
+			RecordIdempotentWrite(ctx)
+			ctx.JSON(http.StatusBadGateway, gin.H{"error": "timeout"})
+		})
+
+		assert.Eq(t, http.StatusBadGateway, w.Code)
+		assert.Eq(t, []string{"insert", "findAndModify"}, commandNames(mt))
+		stored := mt.GetAllStartedEvents()[1].Command
+		assert.Eq(t, int64(http.StatusBadGateway), stored.Lookup("update", "$set", "status_code").AsInt64())
+	})
+
+	mt.Run("panic after the disbursement was created", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{{Key: "_id", Value: primitive.NewObjectID()}}}))
+
+		w := serveIdempotent(mt, func(ctx *gin.Context) {
+			RecordIdempotentWrite(ctx)
+			panic("boom")
+		})
+
+		assert.Eq(t, http.StatusInternalServerError, w.Code)
+		assert.Eq(t, []string{"insert", "findAndModify"}, commandNames(mt))
+	})
+}
@@ -0,0 +1,9 @@
+package common
+
+import "context"
+
+// JobRunner runs work in the background for as long as the application runs.
+// The work is handed a context cancelled on shutdown, which waits for it to return.
+type JobRunner interface {
+	Go(job func(ctx context.Context))
+}
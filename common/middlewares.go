@@ -21,6 +21,7 @@ const (
 	repositoryContextKey = "__yc_repo"
 	poolContextKey       = "__yc_pool"
 	loggerContextKey     = "__yc_logger"
+	jobsContextKey       = "__yc_jobs"
 	UserKey              = "__user"
 )
 
@@ -44,6 +45,10 @@ func LoggerFromCtx(ctx *gin.Context) internals.Logger {
 	return ctx.MustGet(loggerContextKey).(internals.Logger)
 }
 
+func JobsFromCtx(ctx *gin.Context) JobRunner {
+	return ctx.MustGet(jobsContextKey).(JobRunner)
+}
+
 func AddConfigMiddleware(cfg *Config) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ctx.Set(configContextKey, cfg)
@@ -51,6 +56,13 @@ func AddConfigMiddleware(cfg *Config) gin.HandlerFunc {
 	}
 }
 
+func AddJobsMiddleware(jobs JobRunner) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(jobsContextKey, jobs)
+		ctx.Next()
+	}
+}
+
 func AddLoggerMiddleware(logger internals.Logger) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ctx.Set(loggerContextKey, logger)
@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"yc-backend/common"
+	"yc-backend/models"
+	"yc-backend/services"
+	"yc-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ApprovalPolicyRequest struct {
+	Enabled               bool     `json:"enabled"`
+	Threshold             float64  `json:"threshold"`
+	RequireForPayrollRuns bool     `json:"requireForPayrollRuns"`
+	Approvers             []string `json:"approvers"`
+}
+
+type ApprovalDecisionRequest struct {
+	Comment string `json:"comment,omitempty"`
+}
+
+func UpsertApprovalPolicy(ctx *gin.Context) {
+	logger := common.LoggerFromCtx(ctx)
+	repo := common.ReposFromCtx(ctx)
+
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	var policyRequest ApprovalPolicyRequest
+	if err := ctx.ShouldBindJSON(&policyRequest); err != nil {
+		logger.Errorf("bind request to ApprovalPolicyRequest failed: %v", err)
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+	if policyRequest.Threshold < 0 {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(errors.New("threshold cannot be negative")))
+		return
+	}
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	approvers := []primitive.ObjectID{}
+	for _, email := range policyRequest.Approvers {
+		approver, err := repo.User.FindOne(ctxWithTimeout, bson.D{{Key: "email", Value: strings.ToLower(email)}})
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(fmt.Errorf("no user with email [%s]", email)))
+			return
+		}
+		approvers = append(approvers, approver.ID)
+	}
+	if policyRequest.Enabled && len(approvers) == 0 {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(errors.New("an enabled approval policy needs at least one approver")))
+		return
+	}
+
+	policy, err := disbursementServiceFromCtx(ctx).SaveApprovalPolicy(ctxWithTimeout, models.ApprovalPolicy{
+		UserID:                user.ID,
+		Enabled:               policyRequest.Enabled,
+		Threshold:             policyRequest.Threshold,
+		RequireForPayrollRuns: policyRequest.RequireForPayrollRuns,
+		Approvers:             approvers,
+	}, common.ConfigFromCtx(ctx).IsAdmin(user.Email))
+	if errors.Is(err, services.ErrApprovalLoosened) {
+		ctx.JSON(http.StatusForbidden, utils.ErrorResponse(err))
+		return
+	}
+	if err != nil {
+		logger.Errorf("Error occurred while saving approval policy: %v", err)
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("approval policy saved", policy))
+}
+
+func GetApprovalPolicy(ctx *gin.Context) {
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	policy, err := disbursementServiceFromCtx(ctx).ApprovalPolicy(ctx, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
+	}
+	if policy == nil {
+		ctx.JSON(http.StatusNotFound, utils.ErrorResponse(errors.New("no approval policy configured")))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("", policy))
+}
+
+func ListPendingApprovals(ctx *gin.Context) {
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	disbursements, err := disbursementServiceFromCtx(ctx).PendingApprovals(ctx, user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("", disbursements))
+}
+
+func ApproveDisbursement(ctx *gin.Context) {
+	decideDisbursement(ctx, (*services.DisbursementService).Approve, "disbursement approved successfully")
+}
+
+func RejectDisbursement(ctx *gin.Context) {
+	decideDisbursement(ctx, (*services.DisbursementService).Reject, "disbursement rejected successfully")
+}
+
+type approvalAction func(*services.DisbursementService, context.Context, *models.User, primitive.ObjectID, string) (*models.Disbursement, error)
+
+func decideDisbursement(ctx *gin.Context, action approvalAction, message string) {
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	disbursementId, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	var decision ApprovalDecisionRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&decision); err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+			return
+		}
+	}
+
+	disbursement, err := action(disbursementServiceFromCtx(ctx), ctx, user, disbursementId, decision.Comment)
+	if err != nil {
+		if errors.Is(err, services.ErrInsufficientBalance) {
+			ctx.JSON(http.StatusUnprocessableEntity, insufficientBalanceResponse(err))
+			return
+		}
+		ctx.JSON(approvalErrorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse(message, disbursement))
+}
+
+func ApprovePayrollRun(ctx *gin.Context) {
+	decidePayrollRun(ctx, true)
+}
+
+func RejectPayrollRun(ctx *gin.Context) {
+	decidePayrollRun(ctx, false)
+}
+
+func decidePayrollRun(ctx *gin.Context, approve bool) {
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	runId, err := primitive.ObjectIDFromHex(ctx.Param("runId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	var decision ApprovalDecisionRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&decision); err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+			return
+		}
+	}
+
+	decided, failures, err := disbursementServiceFromCtx(ctx).DecidePayrollRun(ctx, user, runId, approve, decision.Comment)
+	if err != nil {
+		if errors.Is(err, services.ErrInsufficientBalance) {
+			ctx.JSON(http.StatusUnprocessableEntity, insufficientBalanceResponse(err))
+			return
+		}
+		ctx.JSON(approvalErrorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("", gin.H{
+		"decided":  decided,
+		"failures": failures,
+	}))
+}
+
+func approvalErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrNotAnApprover), errors.Is(err, services.ErrSelfApproval):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrNotAwaitingApproval):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
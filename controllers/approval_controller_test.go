@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"yc-backend/models"
+
+	"github.com/gookit/goutil/testutil/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestOwnerCannotDisableApprovalPolicyAlone(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("owner disables the policy", func(mt *mtest.T) {
+		user := &models.User{ID: primitive.NewObjectID(), Email: "owner@example.com"}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "yc.approval_policies", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "user_id", Value: user.ID},
+			{Key: "enabled", Value: true},
+			{Key: "threshold", Value: 1000.0},
+			{Key: "approvers", Value: bson.A{primitive.NewObjectID()}},
+		}))
+
+		r := testRouter(mt, user)
+		r.PUT("/approval-policy", UpsertApprovalPolicy)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/approval-policy", strings.NewReader(`{"enabled":false}`)))
+
+		assert.Eq(t, http.StatusForbidden, w.Code)
+		// the policy was only read
+		assert.Eq(t, 1, len(mt.GetAllStartedEvents()))
+		assert.Eq(t, "find", mt.GetStartedEvent().CommandName)
+	})
+}
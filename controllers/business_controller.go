@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+	"yc-backend/common"
+	"yc-backend/models"
+	"yc-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type BusinessProfileRequest struct {
+	RegisteredName     string `json:"registeredName"`
+	RegistrationNumber string `json:"registrationNumber"`
+	TaxID              string `json:"taxId,omitempty"`
+	BusinessType       string `json:"businessType,omitempty"`
+	IncorporatedOn     string `json:"incorporatedOn,omitempty"`
+	Address            string `json:"address"`
+	City               string `json:"city,omitempty"`
+	Country            string `json:"country"`
+	Email              string `json:"email"`
+	Phone              string `json:"phone"`
+	Website            string `json:"website,omitempty"`
+}
+
+func UpsertBusinessProfile(ctx *gin.Context) {
+	logger := common.LoggerFromCtx(ctx)
+	repo := common.ReposFromCtx(ctx)
+
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	var profileRequest BusinessProfileRequest
+	if err := ctx.ShouldBindJSON(&profileRequest); err != nil {
+		logger.Errorf("bind request to BusinessProfileRequest failed: %v", err)
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	timeNow := time.Now()
+	business := models.Business{
+		UserID:             user.ID,
+		RegisteredName:     strings.TrimSpace(profileRequest.RegisteredName),
+		RegistrationNumber: strings.TrimSpace(profileRequest.RegistrationNumber),
+		TaxID:              strings.TrimSpace(profileRequest.TaxID),
+		BusinessType:       profileRequest.BusinessType,
+		IncorporatedOn:     profileRequest.IncorporatedOn,
+		Address:            strings.TrimSpace(profileRequest.Address),
+		City:               profileRequest.City,
+		Country:            strings.ToUpper(strings.TrimSpace(profileRequest.Country)),
+		Email:              strings.TrimSpace(profileRequest.Email),
+		Phone:              strings.TrimSpace(profileRequest.Phone),
+		Website:            profileRequest.Website,
+		UpdatedAt:          &timeNow,
+	}
+	if err := validateBusinessProfile(business); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	existing, err := repo.Business.FindOne(ctxWithTimeout, bson.D{{Key: "user_id", Value: user.ID}})
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		var id any
+		business.CreatedAt = &timeNow
+		id, err = repo.Business.Create(ctxWithTimeout, business)
+		if businessId, ok := id.(primitive.ObjectID); ok {
+			business.ID = businessId
+		}
+	case err == nil:
+		business.ID = existing.ID
+		business.CreatedAt = existing.CreatedAt
+		err = repo.Business.UpdateOneById(ctxWithTimeout, existing.ID, business)
+	}
+	if err != nil {
+		logger.Errorf("Error occurred while saving business profile: %v", err)
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("business profile saved", business))
+}
+
+func GetBusinessProfile(ctx *gin.Context) {
+	repo := common.ReposFromCtx(ctx)
+
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	business, err := repo.Business.FindOne(ctx, bson.D{{Key: "user_id", Value: user.ID}})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		ctx.JSON(http.StatusNotFound, utils.ErrorResponse(errors.New("no business profile has been set up")))
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("", business))
+}
+
+func validateBusinessProfile(business models.Business) error {
+	if missing := business.MissingFields(); len(missing) > 0 {
+		return fmt.Errorf("business profile is missing %s", strings.Join(missing, ", "))
+	}
+	if len(business.Country) != 2 {
+		return fmt.Errorf("country must be a two-letter country code, got [%s]", business.Country)
+	}
+	if _, err := mail.ParseAddress(business.Email); err != nil {
+		return fmt.Errorf("invalid business email [%s]", business.Email)
+	}
+	if business.IncorporatedOn != "" {
+		if _, err := time.Parse("2006-01-02", business.IncorporatedOn); err != nil {
+			return errors.New("incorporatedOn must be a date in the form YYYY-MM-DD")
+		}
+	}
+	return nil
+}
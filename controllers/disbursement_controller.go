@@ -1,120 +1,477 @@
 package controllers
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"time"
+	"strings"
 	"yc-backend/common"
 	"yc-backend/models"
-	"yc-backend/pkg"
+	"yc-backend/repository"
+	"yc-backend/services"
 	"yc-backend/utils"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+func disbursementServiceFromCtx(ctx *gin.Context) *services.DisbursementService {
+	return services.NewDisbursementService(
+		common.ConfigFromCtx(ctx),
+		common.ReposFromCtx(ctx),
+		common.LoggerFromCtx(ctx))
+}
+
 func MakeDisbursmentToEmployee(ctx *gin.Context) {
-	repo := common.ReposFromCtx(ctx)
+	disbursementRequest, ok := disbursementRequestFromCtx(ctx)
+	if !ok {
+		return
+	}
+	disburse(ctx, disbursementRequest)
+}
+
+type OffCyclePaymentRequest struct {
+	Type   string  `json:"type"`
+	Amount float64 `json:"amount"`
+	Reason string  `json:"reason,omitempty"`
+	Note   string  `json:"note,omitempty"`
+}
+
+// MakeOffCyclePayment pays the employee a bonus, reimbursement or arrears
+// outside the payroll.
+func MakeOffCyclePayment(ctx *gin.Context) {
 	logger := common.LoggerFromCtx(ctx)
-	cfg := common.ConfigFromCtx(ctx)
 
+	var paymentRequest OffCyclePaymentRequest
+	if err := ctx.ShouldBindJSON(&paymentRequest); err != nil {
+		logger.Errorf("bind request to OffCyclePaymentRequest failed: %v", err)
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+	paymentRequest.Type = strings.ToLower(strings.TrimSpace(paymentRequest.Type))
+	paymentRequest.Reason = strings.ToLower(strings.TrimSpace(paymentRequest.Reason))
+	if err := validateOffCyclePayment(paymentRequest); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	disbursementRequest, ok := disbursementRequestFromCtx(ctx)
+	if !ok {
+		return
+	}
+	disbursementRequest.PaymentType = paymentRequest.Type
+	disbursementRequest.Amount = paymentRequest.Amount
+	disbursementRequest.Reason = paymentRequest.Reason
+	disbursementRequest.Note = strings.TrimSpace(paymentRequest.Note)
+	disburse(ctx, disbursementRequest)
+}
+
+func validateOffCyclePayment(paymentRequest OffCyclePaymentRequest) error {
+	if !lo.Contains(models.OffCyclePaymentTypes, paymentRequest.Type) {
+		return fmt.Errorf("payment type must be one of %s", strings.Join(models.OffCyclePaymentTypes, ", "))
+	}
+	if paymentRequest.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	if paymentRequest.Reason != "" && !lo.Contains(models.PaymentReasons, paymentRequest.Reason) {
+		return fmt.Errorf("reason must be one of %s", strings.Join(models.PaymentReasons, ", "))
+	}
+	return nil
+}
+
+// disbursementRequestFromCtx builds the request to pay the employee in the
+// route, writing the error response when it cannot.
+func disbursementRequestFromCtx(ctx *gin.Context) (services.DisbursementRequest, bool) {
 	user, ok := ctx.MustGet(common.UserKey).(*models.User)
 	if !ok {
 		err := fmt.Errorf("error occurred while creating user")
 		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return services.DisbursementRequest{}, false
+	}
+
+	// the route shares its wildcard with /:id/accept, so the parameter is named id
+	employee, ok := employeeOfUserParam(ctx, "id")
+	if !ok {
+		return services.DisbursementRequest{}, false
+	}
+
+	overrideLimits := ctx.Query("overrideLimits") == "true"
+	if overrideLimits && !common.ConfigFromCtx(ctx).IsAdmin(user.Email) {
+		ctx.JSON(http.StatusForbidden, utils.ErrorResponse(errors.New("only admins can override spending limits")))
+		return services.DisbursementRequest{}, false
+	}
+
+	return services.DisbursementRequest{
+		User:           user,
+		Employee:       employee,
+		Quote:          ctx.Query("quote") == "true",
+		OverrideLimits: overrideLimits,
+	}, true
+}
+
+func disburse(ctx *gin.Context, disbursementRequest services.DisbursementRequest) {
+	if ctx.Query("dryRun") == "true" {
+		dryRun, err := disbursementServiceFromCtx(ctx).DryRunDisbursement(ctx, disbursementRequest)
+		if err != nil {
+			ctx.JSON(dryRunErrorStatus(err), utils.ErrorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusOK, utils.SuccessResponse("dry run, nothing was submitted", dryRun))
 		return
 	}
 
-	employeeId, err := primitive.ObjectIDFromHex(ctx.Param("employeeId"))
+	disbursment, err := disbursementServiceFromCtx(ctx).Disburse(ctx, disbursementRequest)
+	if errors.Is(err, services.ErrInsufficientBalance) {
+		ctx.JSON(http.StatusUnprocessableEntity, insufficientBalanceResponse(err))
+		return
+	}
+	if services.IsUnpayable(err) || errors.Is(err, services.ErrLimitExceeded) {
+		ctx.JSON(http.StatusUnprocessableEntity, utils.ErrorResponse(err))
+		return
+	}
+	if err != nil && disbursment != nil {
+		ctx.JSON(http.StatusBadGateway, submissionErrorResponse(err, disbursment))
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
 		return
 	}
 
-	query := primitive.D{{Key: "_id", Value: employeeId}}
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("disbursement submitted successfully", disbursment))
+}
+
+func AcceptDisbursement(ctx *gin.Context) {
+	actOnDisbursement(ctx, (*services.DisbursementService).AcceptQuote, "disbursement accepted successfully")
+}
+
+func DenyDisbursement(ctx *gin.Context) {
+	actOnDisbursement(ctx, (*services.DisbursementService).DenyQuote, "disbursement denied successfully")
+}
 
-	employee, err := repo.Employee.FindOne(ctx, query)
+func RetryDisbursement(ctx *gin.Context) {
+	actOnDisbursement(ctx, (*services.DisbursementService).Retry, "disbursement retried successfully")
+}
+
+type disbursementAction func(*services.DisbursementService, context.Context, primitive.ObjectID, primitive.ObjectID) (*models.Disbursement, error)
+
+func actOnDisbursement(ctx *gin.Context, action disbursementAction, message string) {
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	disbursementId, err := primitive.ObjectIDFromHex(ctx.Param("id"))
 	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	disbursement, err := action(disbursementServiceFromCtx(ctx), ctx, user.ID, disbursementId)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		ctx.JSON(http.StatusNotFound, utils.ErrorResponse(errors.New("disbursement not found")))
+		return
+	case errors.Is(err, services.ErrNotAQuote),
+		errors.Is(err, services.ErrNotRetryable),
+		errors.Is(err, services.ErrAlreadyRetried),
+		errors.Is(err, services.ErrAttemptReceived):
+		ctx.JSON(http.StatusConflict, utils.ErrorResponse(err))
+		return
+	case errors.Is(err, services.ErrRetryUnconfirmed):
+		ctx.JSON(http.StatusBadGateway, utils.ErrorResponse(err))
+		return
+	case errors.Is(err, services.ErrInsufficientBalance):
+		ctx.JSON(http.StatusUnprocessableEntity, insufficientBalanceResponse(err))
+		return
+	case errors.Is(err, services.ErrQuoteExpired),
+		errors.Is(err, services.ErrLimitExceeded),
+		services.IsUnpayable(err):
+		ctx.JSON(http.StatusUnprocessableEntity, utils.ErrorResponse(err))
+		return
+	case err != nil && disbursement != nil:
+		ctx.JSON(http.StatusBadGateway, submissionErrorResponse(err, disbursement))
+		return
+	case err != nil:
 		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
 		return
 	}
 
-	client := pkg.NewYellowClient(
-		cfg.YellowCardCredentials.BaseUrl,
-		cfg.YellowCardCredentials.ApiKey,
-		cfg.YellowCardCredentials.SecretKey)
-
-	paymentDetails := map[string]interface{}{
-		"channelId":   "fe8f4989-3bf6-41ca-9621-ffe2bc127569",
-		"sequenceId":  uuid.New().String(),
-		"localAmount": employee.Salary,
-		"reason":      "other",
-		"sender": map[string]interface{}{
-			"name":               user.FirstName + " " + user.LastName,
-			"phone":              user.Phone,
-			"country":            user.Country,
-			"address":            user.Address,
-			"dob":                user.DOB,
-			"email":              user.Email,
-			"idNumber":           user.IdNumber,
-			"idType":             user.IdType,
-			"businessId":         "B1234567",
-			"businessName":       "Example Inc.",
-			"additionalIdType":   user.AdditionalIdType,
-			"additionalIdNumber": user.AdditionalIdNumber,
-		},
-		"destination": map[string]interface{}{
-			"accountNumber": employee.AccountName,
-			"accountType":   "bank",
-			"networkId":     "31cfcc77-8904-4f86-879c-a0d18b4b9365",
-			"accountBank":   employee.BankName,
-			"networkName":   "Guaranty Trust Bank",
-			"country":       employee.Country,
-			"accountName":   employee.FirstName + " " + employee.LastName,
-			"phoneNumber":   employee.Phone,
-		},
-		"forceAccept":  true,
-		"customerType": "retail",
-	}
-
-	var payment models.Payment
-	resp, err := client.MakeRequest(http.MethodPost, "/business/payments", paymentDetails)
+	ctx.JSON(http.StatusOK, utils.SuccessResponse(message, disbursement))
+}
+
+func dryRunErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrNoEmployees):
+		return http.StatusBadRequest
+	case services.IsUnpayable(err):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// insufficientBalanceResponse is the error response of a failed balance
+// preflight, carrying the shortfall report as its data.
+func insufficientBalanceResponse(err error) gin.H {
+	response := utils.ErrorResponse(err)
+	var shortfall *services.InsufficientBalanceError
+	if errors.As(err, &shortfall) {
+		response["data"] = shortfall.Reports
+	}
+	return response
+}
+
+// submissionErrorResponse is the error response of a disbursement that was
+// recorded but could not be submitted, carrying the disbursement as its data so
+// its outcome can be followed rather than the request sent again.
+func submissionErrorResponse(err error, disbursement *models.Disbursement) gin.H {
+	response := utils.ErrorResponse(err)
+	response["data"] = disbursement
+	return response
+}
+
+type DisbursementHistoryResponse struct {
+	Status  models.DisbursementStatus `json:"status"`
+	History []models.StatusChange     `json:"history"`
+}
+
+func GetDisbursementHistory(ctx *gin.Context) {
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	disbursementId, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	disbursement, err := disbursementServiceFromCtx(ctx).FindDisbursement(ctx, user.ID, disbursementId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		ctx.JSON(http.StatusNotFound, utils.ErrorResponse(errors.New("disbursement not found")))
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
 		return
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("", DisbursementHistoryResponse{
+		Status:  disbursement.Status,
+		History: disbursement.StatusHistory,
+	}))
+}
+
+type ListDisbursementsQuery struct {
+	Status     string   `form:"status"`
+	EmployeeID string   `form:"employeeId"`
+	Type       string   `form:"type"`
+	From       string   `form:"from"`
+	To         string   `form:"to"`
+	MinAmount  *float64 `form:"minAmount"`
+	MaxAmount  *float64 `form:"maxAmount"`
+	Sort       string   `form:"sort"`
+	Order      string   `form:"order"`
+	Limit      int64    `form:"limit"`
+	Cursor     string   `form:"cursor"`
+}
+
+var disbursementSortFields = map[string]string{
+	"":          "createdAt",
+	"createdAt": "createdAt",
+	"amount":    "salary_amount",
+}
+
+func (q ListDisbursementsQuery) toFilter() (services.DisbursementFilter, repository.PageQuery, error) {
+	var (
+		filter services.DisbursementFilter
+		page   repository.PageQuery
+		err    error
+	)
+
+	if q.Status != "" {
+		for _, status := range strings.Split(q.Status, ",") {
+			filter.Statuses = append(filter.Statuses, models.DisbursementStatus(strings.TrimSpace(status)))
+		}
+	}
+	if q.EmployeeID != "" {
+		if filter.EmployeeID, err = primitive.ObjectIDFromHex(q.EmployeeID); err != nil {
+			return filter, page, fmt.Errorf("invalid employeeId [%s]", q.EmployeeID)
+		}
+	}
+	if q.Type != "" {
+		for _, paymentType := range strings.Split(q.Type, ",") {
+			filter.PaymentTypes = append(filter.PaymentTypes, strings.TrimSpace(paymentType))
+		}
+	}
+	if filter.From, err = utils.ParseTime(q.From, false); err != nil {
+		return filter, page, err
+	}
+	if filter.To, err = utils.ParseTime(q.To, true); err != nil {
+		return filter, page, err
+	}
+	filter.MinAmount, filter.MaxAmount = q.MinAmount, q.MaxAmount
+
+	sortField, ok := disbursementSortFields[q.Sort]
+	if !ok {
+		return filter, page, fmt.Errorf("cannot sort disbursements by [%s]", q.Sort)
+	}
+	if q.Order != "" && q.Order != "asc" && q.Order != "desc" {
+		return filter, page, fmt.Errorf("invalid sort order [%s]", q.Order)
+	}
+
+	page = repository.PageQuery{
+		SortField: sortField,
+		SortDesc:  q.Order != "asc",
+		Limit:     q.Limit,
+		Cursor:    q.Cursor,
+	}
+	return filter, page, nil
+}
+
+func ListDisbursements(ctx *gin.Context) {
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	var query ListDisbursementsQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+	filter, page, err := query.toFilter()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	disbursements, err := disbursementServiceFromCtx(ctx).ListDisbursements(ctx, user.ID, filter, page)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
 		return
 	}
-	err = json.Unmarshal(body, &payment)
 
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("", disbursements))
+}
+
+// EstimateDisbursements previews what paying the employee in employeeId, or
+// the whole workforce when it is empty, will cost.
+func EstimateDisbursements(ctx *gin.Context) {
+	repo := common.ReposFromCtx(ctx)
+
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	var employee *models.Employee
+	if employeeIdParam := ctx.Query("employeeId"); employeeIdParam != "" {
+		employeeId, err := primitive.ObjectIDFromHex(employeeIdParam)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(fmt.Errorf("invalid employeeId [%s]", employeeIdParam)))
+			return
+		}
+		employee, err = repo.Employee.FindOne(ctx, bson.D{
+			{Key: "_id", Value: employeeId},
+			{Key: "user_id", Value: user.ID},
+		})
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			ctx.JSON(http.StatusNotFound, utils.ErrorResponse(errors.New("employee not found")))
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+			return
+		}
+	}
+
+	estimate, err := disbursementServiceFromCtx(ctx).EstimatePayroll(ctx, user, employee)
+	if errors.Is(err, services.ErrNoEmployees) {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("", estimate))
+}
+
+func GetDisbursement(ctx *gin.Context) {
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	disbursementId, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	svc := disbursementServiceFromCtx(ctx)
+	disbursement, err := svc.FindDisbursement(ctx, user.ID, disbursementId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		ctx.JSON(http.StatusNotFound, utils.ErrorResponse(errors.New("disbursement not found")))
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
 		return
 	}
+	if len(disbursement.SplitAmounts) > 0 {
+		if disbursement.Parts, err = svc.DisbursementParts(ctx, disbursement.ID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("", disbursement))
+}
 
-	logger.Infof("Payment = %+v", payment)
-	timeNow := time.Now()
-	disbursment := models.Disbursement{
-		ReceiverID:   employee.ID,
-		SenderID:     user.ID,
-		CreatedAt:    &timeNow,
-		SalaryAmount: employee.Salary,
-		Status:       "processing",
-		Payment:      payment,
+func GetDisbursementPayslip(ctx *gin.Context) {
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
 	}
 
-	_, err = repo.Disbursement.Create(ctx, disbursment)
+	disbursementId, err := primitive.ObjectIDFromHex(ctx.Param("id"))
 	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	pdf, fileName, err := disbursementServiceFromCtx(ctx).Payslip(ctx, user.ID, disbursementId)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		ctx.JSON(http.StatusNotFound, utils.ErrorResponse(errors.New("disbursement not found")))
+		return
+	case errors.Is(err, services.ErrPayslipUnavailable):
+		ctx.JSON(http.StatusConflict, utils.ErrorResponse(err))
+		return
+	case err != nil:
 		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
 		return
 	}
 
-	ctx.JSON(http.StatusOK, utils.SuccessResponse("disbursement submitted successfully", disbursment))
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	ctx.Data(http.StatusOK, "application/pdf", pdf)
 }
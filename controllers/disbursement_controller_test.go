@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"yc-backend/common"
+	"yc-backend/internals"
+	"yc-backend/models"
+	"yc-backend/repository"
+	"yc-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gookit/goutil/testutil/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// testRouter serves the handlers as the user, backed by the mock deployment of mt.
+func testRouter(mt *mtest.T, user *models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	cfg := &common.Config{}
+	cfg.MongoDB.DatabaseName = "yc"
+
+	r := gin.New()
+	r.Use(common.AddConfigMiddleware(cfg),
+		common.AddLoggerMiddleware(internals.GetLogger()),
+		common.AddReposToMiddleware(mt.Client),
+		func(ctx *gin.Context) { ctx.Set(common.UserKey, user) })
+	return r
+}
+
+func TestOffCyclePaymentToAnotherBusinessEmployeeIsNotFound(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("foreign employee", func(mt *mtest.T) {
+		user := &models.User{ID: primitive.NewObjectID()}
+		employeeId := primitive.NewObjectID()
+		// the employee belongs to another business, so the scoped lookup finds nothing
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "yc.employees", mtest.FirstBatch))
+
+		r := testRouter(mt, user)
+		r.POST("/disbursements/:id/off-cycle", MakeOffCyclePayment)
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"type":"bonus","amount":1000000}`)
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/disbursements/"+employeeId.Hex()+"/off-cycle", body))
+
+		assert.Eq(t, http.StatusNotFound, w.Code)
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		assert.Eq(t, employeeId, filter.Lookup("_id").ObjectID())
+		assert.Eq(t, user.ID, filter.Lookup("user_id").ObjectID())
+	})
+}
+
+func TestOffCyclePaymentWithInvalidEmployeeIdIsBadRequest(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("invalid id", func(mt *mtest.T) {
+		r := testRouter(mt, &models.User{ID: primitive.NewObjectID()})
+		r.POST("/disbursements/:id/off-cycle", MakeOffCyclePayment)
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"type":"bonus","amount":10}`)
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/disbursements/not-an-id/off-cycle", body))
+
+		assert.Eq(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestFailedSubmissionIsAnsweredWithTheDisbursement(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("submission timed out", func(mt *mtest.T) {
+		disbursement := &models.Disbursement{ID: primitive.NewObjectID(), Status: models.DisbursementCreated}
+		submit := func(*services.DisbursementService, context.Context, primitive.ObjectID, primitive.ObjectID) (*models.Disbursement, error) {
+			return disbursement, services.ErrSubmissionUnconfirmed
+		}
+
+		r := testRouter(mt, &models.User{ID: primitive.NewObjectID()})
+		r.POST("/disbursements/:id/retry", func(ctx *gin.Context) { actOnDisbursement(ctx, submit, "") })
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/disbursements/"+disbursement.ID.Hex()+"/retry", nil))
+
+		assert.Eq(t, http.StatusBadGateway, w.Code)
+		var response struct {
+			Error string              `json:"error"`
+			Data  models.Disbursement `json:"data"`
+		}
+		assert.NoErr(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.StrContains(t, response.Error, services.ErrSubmissionUnconfirmed.Error())
+		assert.Eq(t, disbursement.ID, response.Data.ID)
+	})
+}
+
+func TestListDisbursementsQueryToFilter(t *testing.T) {
+	employeeId := primitive.NewObjectID()
+
+	tests := []struct {
+		name  string
+		query ListDisbursementsQuery
+		check func(t *testing.T, filter services.DisbursementFilter, page repository.PageQuery)
+		err   string
+	}{
+		{
+			name:  "defaults",
+			query: ListDisbursementsQuery{},
+			check: func(t *testing.T, filter services.DisbursementFilter, page repository.PageQuery) {
+				assert.Len(t, filter.Statuses, 0)
+				assert.True(t, filter.EmployeeID.IsZero())
+				assert.Nil(t, filter.From)
+				assert.Nil(t, filter.To)
+				assert.Eq(t, "createdAt", page.SortField)
+				assert.True(t, page.SortDesc)
+			},
+		},
+		{
+			name: "status, date range and employee",
+			query: ListDisbursementsQuery{
+				Status:     "failed, completed",
+				EmployeeID: employeeId.Hex(),
+				From:       "2024-03-01",
+				To:         "2024-03-31",
+				Sort:       "amount",
+				Order:      "asc",
+			},
+			check: func(t *testing.T, filter services.DisbursementFilter, page repository.PageQuery) {
+				assert.Eq(t, []models.DisbursementStatus{models.DisbursementFailed, models.DisbursementCompleted}, filter.Statuses)
+				assert.Eq(t, employeeId, filter.EmployeeID)
+				assert.Eq(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), *filter.From)
+				// the end date covers the whole day
+				assert.Eq(t, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond), *filter.To)
+				assert.Eq(t, "salary_amount", page.SortField)
+				assert.False(t, page.SortDesc)
+			},
+		},
+		{
+			name:  "timestamp range",
+			query: ListDisbursementsQuery{From: "2024-03-01T10:00:00Z", To: "2024-03-01T12:00:00Z"},
+			check: func(t *testing.T, filter services.DisbursementFilter, page repository.PageQuery) {
+				assert.Eq(t, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), filter.From.UTC())
+				assert.Eq(t, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), filter.To.UTC())
+			},
+		},
+		{name: "invalid employee", query: ListDisbursementsQuery{EmployeeID: "not-an-id"}, err: "invalid employeeId"},
+		{name: "invalid date", query: ListDisbursementsQuery{From: "01/03/2024"}, err: "invalid date"},
+		{name: "unknown sort", query: ListDisbursementsQuery{Sort: "name"}, err: "cannot sort"},
+		{name: "invalid order", query: ListDisbursementsQuery{Order: "up"}, err: "invalid sort order"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, page, err := tt.query.toFilter()
+			if tt.err != "" {
+				assert.Err(t, err)
+				assert.StrContains(t, err.Error(), tt.err)
+				return
+			}
+			assert.NoErr(t, err)
+			tt.check(t, filter, page)
+		})
+	}
+}
+
+func TestListDisbursementsFiltersTheQuery(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("filtered", func(mt *mtest.T) {
+		user := &models.User{ID: primitive.NewObjectID()}
+		employeeId := primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "yc.disbursements", mtest.FirstBatch))
+
+		r := testRouter(mt, user)
+		r.GET("/disbursements", ListDisbursements)
+		w := httptest.NewRecorder()
+		url := "/disbursements?status=failed,completed&from=2024-03-01&to=2024-03-31&employeeId=" + employeeId.Hex()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+
+		assert.Eq(t, http.StatusOK, w.Code)
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		assert.Eq(t, user.ID, filter.Lookup("sender_id").ObjectID())
+		assert.Eq(t, employeeId, filter.Lookup("receiver_id").ObjectID())
+		statuses := filter.Lookup("status", "$in").Array()
+		assert.Eq(t, string(models.DisbursementFailed), statuses.Index(0).Value().StringValue())
+		assert.Eq(t, string(models.DisbursementCompleted), statuses.Index(1).Value().StringValue())
+		assert.Eq(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), filter.Lookup("createdAt", "$gte").Time().UTC())
+		assert.Eq(t, time.Date(2024, 3, 31, 23, 59, 59, 999000000, time.UTC), filter.Lookup("createdAt", "$lte").Time().UTC())
+	})
+}
+
+func TestListDisbursementsWithMalformedCursorIsBadRequest(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("malformed cursor", func(mt *mtest.T) {
+		r := testRouter(mt, &models.User{ID: primitive.NewObjectID()})
+		r.GET("/disbursements", ListDisbursements)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/disbursements?cursor=not-a-cursor!", nil))
+
+		assert.Eq(t, http.StatusBadRequest, w.Code)
+		assert.StrContains(t, w.Body.String(), repository.ErrInvalidCursor.Error())
+		assert.Len(t, mt.GetAllStartedEvents(), 0)
+	})
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"yc-backend/common"
+	"yc-backend/models"
+	"yc-backend/services"
+	"yc-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SpendingLimitsRequest struct {
+	Business  models.SpendingLimits           `json:"business"`
+	Employee  models.SpendingLimits           `json:"employee"`
+	Employees []models.EmployeeSpendingLimits `json:"employees"`
+}
+
+func GetSpendingLimits(ctx *gin.Context) {
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	policy, err := disbursementServiceFromCtx(ctx).SpendingLimitPolicy(ctx, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("", policy))
+}
+
+func UpdateSpendingLimits(ctx *gin.Context) {
+	logger := common.LoggerFromCtx(ctx)
+	cfg := common.ConfigFromCtx(ctx)
+
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	var limitsRequest SpendingLimitsRequest
+	if err := ctx.ShouldBindJSON(&limitsRequest); err != nil {
+		logger.Errorf("bind request to SpendingLimitsRequest failed: %v", err)
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+	if err := validateSpendingLimits(limitsRequest); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	policy, err := disbursementServiceFromCtx(ctx).SaveSpendingLimitPolicy(ctx, models.SpendingLimitPolicy{
+		UserID:    user.ID,
+		Business:  limitsRequest.Business,
+		Employee:  limitsRequest.Employee,
+		Employees: limitsRequest.Employees,
+	}, cfg.IsAdmin(user.Email))
+	if errors.Is(err, services.ErrLimitsRaised) {
+		ctx.JSON(http.StatusForbidden, utils.ErrorResponse(err))
+		return
+	}
+	if err != nil {
+		logger.Errorf("Error occurred while saving spending limits: %v", err)
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("spending limits saved", policy))
+}
+
+func validateSpendingLimits(limitsRequest SpendingLimitsRequest) error {
+	limits := []models.SpendingLimits{limitsRequest.Business, limitsRequest.Employee}
+	for _, override := range limitsRequest.Employees {
+		if override.EmployeeID.IsZero() {
+			return errors.New("employee limits need an employeeId")
+		}
+		limits = append(limits, override.Limits)
+	}
+	for _, limit := range limits {
+		if limit.PerTransaction < 0 || limit.Daily < 0 || limit.Monthly < 0 {
+			return errors.New("spending limits cannot be negative")
+		}
+	}
+	return nil
+}
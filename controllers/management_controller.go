@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 	"yc-backend/common"
 	"yc-backend/models"
+	"yc-backend/services"
 	"yc-backend/utils"
 
 	"github.com/gin-gonic/gin"
@@ -31,8 +33,14 @@ type CreateEmployeeRequest struct {
 	AdditionalIDType string  `json:"additionalIdType,omitempty"`
 	Salary           float64 `json:"salary,omitempty" validate:"required"`
 	AccountName      string  `json:"account_name,omitempty" validate:"required"`
+	AccountNumber    string  `json:"account_number,omitempty"`
 	BankName         string  `json:"bank_name,omitempty" validate:"required"`
 	AccountType      string  `json:"account_type,omitempty" validate:"required"`
+	NetworkID        string  `json:"networkId,omitempty"`
+	Currency         string  `json:"currency,omitempty"`
+	SalaryCurrency   string  `json:"salaryCurrency,omitempty"`
+
+	PayComponents *models.PayComponents `json:"payComponents,omitempty"`
 }
 
 type UpdateEmployeeRequest struct {
@@ -47,9 +55,16 @@ type UpdateEmployeeRequest struct {
 	AdditionalIDType string  `json:"additionalIdType,omitempty"`
 	Salary           float64 `json:"salary,omitempty" validate:"required"`
 	AccountName      string  `json:"account_name,omitempty" validate:"required"`
+	AccountNumber    string  `json:"account_number,omitempty"`
 	BankName         string  `json:"bank_name,omitempty" validate:"required"`
 	AccountType      string  `json:"account_type,omitempty" validate:"required"`
+	NetworkID        string  `json:"networkId,omitempty"`
+	Currency         string  `json:"currency,omitempty"`
+	SalaryCurrency   string  `json:"salaryCurrency,omitempty"`
 	Bvn              string  `json:"bvn,omitempty" validate:"required"`
+	Status           string  `json:"status,omitempty"`
+
+	PayComponents *models.PayComponents `json:"payComponents,omitempty"`
 }
 
 func AddEmployee(ctx *gin.Context) {
@@ -71,6 +86,13 @@ func AddEmployee(ctx *gin.Context) {
 
 	logger.Infof("Received employee request: %+v", employeeRequest)
 
+	accountType, accountNumber, err := payoutAccount(employeeRequest.AccountType,
+		employeeRequest.Country, employeeRequest.AccountNumber, employeeRequest.Phone)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
 	timeNow := time.Now()
 	dobTIme, err := time.Parse("2006-01-02", employeeRequest.DOB)
 	if err != nil {
@@ -96,9 +118,35 @@ func AddEmployee(ctx *gin.Context) {
 		BankName:         employeeRequest.BankName,
 		Country:          employeeRequest.Country,
 		AccountName:      employeeRequest.AccountName,
-		AccountType:      employeeRequest.AccountType,
+		AccountNumber:    accountNumber,
+		AccountType:      accountType,
+		NetworkID:        employeeRequest.NetworkID,
+		Currency:         strings.ToUpper(employeeRequest.Currency),
+		SalaryCurrency:   strings.ToUpper(employeeRequest.SalaryCurrency),
 		UserID:           user.ID,
+		Status:           models.EmployeeActive,
+		PayComponents:    employeeRequest.PayComponents,
+	}
+	if err := validatePayComponents(employee.PayComponents); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+	if err := validateSalaryCurrency(employee); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+	if employee.PayComponents != nil {
+		employee.Salary = services.ComputePay(&employee).Gross
+	}
+
+	disbursementService := disbursementServiceFromCtx(ctx)
+	route, err := disbursementService.ResolveRoute(ctx, &employee)
+	if err != nil {
+		ctx.JSON(routeErrorStatus(err), utils.ErrorResponse(err))
+		return
 	}
+	employee.NetworkID = route.Network.ID
+	employee.AccountVerification = disbursementService.VerifyAccount(ctx, &employee)
 
 	ctxWithTimeout, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
@@ -163,11 +211,11 @@ func UpdateEmployee(ctx *gin.Context) {
 	repo := common.ReposFromCtx(ctx)
 	logger := common.LoggerFromCtx(ctx)
 
-	employeeId, err := primitive.ObjectIDFromHex(ctx.Param("employeeId"))
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+	existing, ok := employeeOfUser(ctx)
+	if !ok {
 		return
 	}
+	employeeId := existing.ID
 
 	var employeeeRequest UpdateEmployeeRequest
 
@@ -177,6 +225,13 @@ func UpdateEmployee(ctx *gin.Context) {
 		return
 	}
 
+	if employeeeRequest.Status != "" &&
+		employeeeRequest.Status != models.EmployeeActive &&
+		employeeeRequest.Status != models.EmployeeInactive {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(fmt.Errorf("invalid employee status [%s]", employeeeRequest.Status)))
+		return
+	}
+
 	updatedAt := time.Now()
 	employee := models.Employee{
 		FirstName:        employeeeRequest.FirstName,
@@ -189,10 +244,47 @@ func UpdateEmployee(ctx *gin.Context) {
 		AdditionalIDType: employeeeRequest.AdditionalIDType,
 		Address:          employeeeRequest.Address,
 		AccountName:      employeeeRequest.AccountName,
+		AccountNumber:    employeeeRequest.AccountNumber,
 		AccountType:      employeeeRequest.AccountType,
 		BankName:         employeeeRequest.BankName,
+		Country:          employeeeRequest.Country,
+		Currency:         strings.ToUpper(employeeeRequest.Currency),
+		SalaryCurrency:   strings.ToUpper(employeeeRequest.SalaryCurrency),
 		BVN:              employeeeRequest.Bvn,
+		Status:           employeeeRequest.Status,
+		PayComponents:    employeeeRequest.PayComponents,
+	}
+	if err := validatePayComponents(employee.PayComponents); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+	if err := validateSalaryCurrency(employee); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+	if employee.PayComponents != nil {
+		employee.Salary = services.ComputePay(&employee).Gross
+	}
+
+	var err error
+	if employee.AccountType != "" || employee.AccountNumber != "" || employee.Country != "" {
+		employee.AccountType, employee.AccountNumber, err = payoutAccount(
+			valueOr(employee.AccountType, existing.AccountType),
+			valueOr(employee.Country, existing.Country),
+			valueOr(employee.AccountNumber, existing.AccountNumber),
+			valueOr(employee.Phone, existing.Phone))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+			return
+		}
+	}
+	networkId, err := resolveUpdatedNetwork(ctx, existing, employee, employeeeRequest.NetworkID)
+	if err != nil {
+		ctx.JSON(routeErrorStatus(err), utils.ErrorResponse(err))
+		return
 	}
+	employee.NetworkID = networkId
+	employee.AccountVerification = reverifyAccount(ctx, existing, employee)
 
 	if err := repo.Employee.UpdateOneById(ctx, employeeId, employee); err != nil {
 		ctx.JSON(http.StatusInternalServerError,
@@ -202,3 +294,245 @@ func UpdateEmployee(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, utils.SuccessResponse("", nil))
 }
+
+// resolveUpdatedNetwork resolves the employee's network again when the update
+// changes where they are paid, and returns the network ID to store, if any.
+func resolveUpdatedNetwork(ctx *gin.Context, existing *models.Employee, update models.Employee, networkId string) (string, error) {
+	routed := *existing
+	if update.Country != "" {
+		routed.Country = update.Country
+	}
+	if update.AccountType != "" {
+		routed.AccountType = update.AccountType
+	}
+	if update.Currency != "" {
+		routed.Currency = update.Currency
+	}
+	if update.BankName != "" && update.BankName != existing.BankName {
+		routed.BankName = update.BankName
+		// the stored network belongs to the previous bank
+		routed.NetworkID = ""
+	}
+	if networkId != "" {
+		routed.NetworkID = networkId
+	}
+
+	if routed.Country == existing.Country &&
+		routed.AccountType == existing.AccountType &&
+		routed.Currency == existing.Currency &&
+		routed.BankName == existing.BankName &&
+		routed.NetworkID == existing.NetworkID && existing.NetworkID != "" {
+		return "", nil
+	}
+
+	route, err := disbursementServiceFromCtx(ctx).ResolveRoute(ctx, &routed)
+	if err != nil {
+		return "", err
+	}
+	return route.Network.ID, nil
+}
+
+// payoutAccount validates the payout method and its account number in the
+// country, and returns both normalised. Mobile money employees without a
+// separate wallet number are paid on their phone number.
+func payoutAccount(method, country, accountNumber, phone string) (string, string, error) {
+	method = strings.ToLower(method)
+	if method == "" {
+		method = models.PayoutBank
+	}
+	if accountNumber == "" && method == models.PayoutMomo {
+		accountNumber = phone
+	}
+	if accountNumber == "" {
+		return "", "", errors.New("account_number is required")
+	}
+	accountNumber, err := services.NormalizeAccountNumber(method, country, accountNumber)
+	if err != nil {
+		return "", "", err
+	}
+	return method, accountNumber, nil
+}
+
+// valueOr returns value, or fallback when value is empty.
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// reverifyAccount checks the account holder again when the update changes the
+// account or the employee's name, or when the account was never verified. It
+// returns nil when the stored verification still holds.
+func reverifyAccount(ctx *gin.Context, existing *models.Employee, update models.Employee) *models.AccountVerification {
+	verified := *existing
+	if update.FirstName != "" {
+		verified.FirstName = update.FirstName
+	}
+	if update.LastName != "" {
+		verified.LastName = update.LastName
+	}
+	if update.AccountNumber != "" {
+		verified.AccountNumber = update.AccountNumber
+	}
+	if update.NetworkID != "" {
+		verified.NetworkID = update.NetworkID
+	}
+
+	if existing.AccountVerification != nil &&
+		existing.AccountVerification.Status == models.AccountVerified &&
+		verified.FirstName == existing.FirstName &&
+		verified.LastName == existing.LastName &&
+		verified.AccountNumber == existing.AccountNumber &&
+		verified.NetworkID == existing.NetworkID {
+		return nil
+	}
+	return disbursementServiceFromCtx(ctx).VerifyAccount(ctx, &verified)
+}
+
+// VerifyEmployeeAccount resolves the employee's account holder again, e.g.
+// after the employee fixed their name with their bank.
+func VerifyEmployeeAccount(ctx *gin.Context) {
+	repo := common.ReposFromCtx(ctx)
+
+	employee, ok := employeeOfUser(ctx)
+	if !ok {
+		return
+	}
+
+	verification := disbursementServiceFromCtx(ctx).VerifyAccount(ctx, employee)
+	if err := repo.Employee.UpdateOneById(ctx, employee.ID, models.Employee{AccountVerification: verification}); err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("", verification))
+}
+
+// validateSalaryCurrency allows salaries in USD or in the payout currency.
+func validateSalaryCurrency(employee models.Employee) error {
+	if employee.SalaryCurrency == "" ||
+		employee.SalaryCurrency == services.USD ||
+		employee.SalaryCurrency == employee.Currency {
+		return nil
+	}
+	return fmt.Errorf("salary currency must be %s or the payout currency, got [%s]", services.USD, employee.SalaryCurrency)
+}
+
+func routeErrorStatus(err error) int {
+	if errors.Is(err, services.ErrNoChannel) || errors.Is(err, services.ErrNoNetwork) || errors.Is(err, services.ErrNoRate) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+func validatePayComponents(components *models.PayComponents) error {
+	if components == nil {
+		return nil
+	}
+	if components.Basic <= 0 {
+		return errors.New("basic salary must be greater than zero")
+	}
+	if components.Housing < 0 || components.Transport < 0 {
+		return errors.New("allowances cannot be negative")
+	}
+	for _, rate := range []float64{components.PensionEmployeeRate, components.PensionEmployerRate} {
+		if rate < 0 || rate > 100 {
+			return errors.New("pension rates must be between 0 and 100")
+		}
+	}
+	for _, item := range append(components.OtherAllowances, components.Deductions...) {
+		if item.Name == "" || item.Amount < 0 {
+			return fmt.Errorf("invalid pay item [%s]", item.Name)
+		}
+	}
+	return nil
+}
+
+func UpdatePayComponents(ctx *gin.Context) {
+	repo := common.ReposFromCtx(ctx)
+	logger := common.LoggerFromCtx(ctx)
+
+	employee, ok := employeeOfUser(ctx)
+	if !ok {
+		return
+	}
+
+	var components models.PayComponents
+	if err := ctx.ShouldBindJSON(&components); err != nil {
+		logger.Infof("bind request to PayComponents failed : %v", err)
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+	if err := validatePayComponents(&components); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	employee.PayComponents = &components
+	breakdown := services.ComputePay(employee)
+	updatedAt := time.Now()
+	if err := repo.Employee.UpdateOneById(ctx, employee.ID, models.Employee{
+		PayComponents: &components,
+		Salary:        breakdown.Gross,
+		UpdatedAt:     &updatedAt,
+	}); err != nil {
+		ctx.JSON(http.StatusInternalServerError,
+			utils.ErrorResponse(fmt.Errorf("could not update employee with id [%v]", employee.ID.String())))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("pay components updated", breakdown))
+}
+
+func GetPayBreakdown(ctx *gin.Context) {
+	employee, ok := employeeOfUser(ctx)
+	if !ok {
+		return
+	}
+
+	breakdown, err := disbursementServiceFromCtx(ctx).PayInPayoutCurrency(ctx, employee)
+	if err != nil {
+		ctx.JSON(routeErrorStatus(err), utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("", breakdown))
+}
+
+// employeeOfUser loads the employee in the route belonging to the logged in user,
+// writing the error response itself when that fails.
+func employeeOfUser(ctx *gin.Context) (*models.Employee, bool) {
+	return employeeOfUserParam(ctx, "employeeId")
+}
+
+// employeeOfUserParam is employeeOfUser for routes naming the employee id param.
+func employeeOfUserParam(ctx *gin.Context, param string) (*models.Employee, bool) {
+	repo := common.ReposFromCtx(ctx)
+
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return nil, false
+	}
+
+	employeeId, err := primitive.ObjectIDFromHex(ctx.Param(param))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return nil, false
+	}
+
+	employee, err := repo.Employee.FindOne(ctx, bson.D{
+		{Key: "_id", Value: employeeId},
+		{Key: "user_id", Value: user.ID},
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		ctx.JSON(http.StatusNotFound, utils.ErrorResponse(errors.New("employee not found")))
+		return nil, false
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return nil, false
+	}
+	return employee, true
+}
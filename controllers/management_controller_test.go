@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"yc-backend/models"
+
+	"github.com/gookit/goutil/testutil/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestUpdateOfAnotherBusinessEmployeeIsNotFound(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("foreign employee", func(mt *mtest.T) {
+		user := &models.User{ID: primitive.NewObjectID()}
+		employeeId := primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "yc.employees", mtest.FirstBatch))
+
+		r := testRouter(mt, user)
+		r.PUT("/employees/:employeeId", UpdateEmployee)
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"firstName":"Ada","salary":1000000}`)
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/employees/"+employeeId.Hex(), body))
+
+		assert.Eq(t, http.StatusNotFound, w.Code)
+		// nothing is updated
+		assert.Len(t, mt.GetAllStartedEvents(), 1)
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		assert.Eq(t, user.ID, filter.Lookup("user_id").ObjectID())
+	})
+}
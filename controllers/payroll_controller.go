@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"yc-backend/common"
+	"yc-backend/models"
+	"yc-backend/services"
+	"yc-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func CreatePayrollRun(ctx *gin.Context) {
+	logger := common.LoggerFromCtx(ctx)
+
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	if ctx.Query("dryRun") == "true" {
+		dryRun, err := disbursementServiceFromCtx(ctx).DryRunPayrollRun(ctx, user)
+		if err != nil {
+			ctx.JSON(dryRunErrorStatus(err), utils.ErrorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusOK, utils.SuccessResponse("dry run, nothing was submitted", dryRun))
+		return
+	}
+
+	run, err := disbursementServiceFromCtx(ctx).StartPayrollRun(ctx, user, common.JobsFromCtx(ctx))
+	if errors.Is(err, services.ErrNoEmployees) {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+	if errors.Is(err, services.ErrInsufficientBalance) {
+		ctx.JSON(http.StatusUnprocessableEntity, insufficientBalanceResponse(err))
+		return
+	}
+	if err != nil {
+		logger.Errorf("Error occurred while starting payroll run: %v", err)
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, utils.SuccessResponse("payroll run started", run))
+}
+
+func GetPayrollRun(ctx *gin.Context) {
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	runId, err := primitive.ObjectIDFromHex(ctx.Param("runId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	summary, err := disbursementServiceFromCtx(ctx).PayrollRunSummary(ctx, user.ID, runId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		ctx.JSON(http.StatusNotFound, utils.ErrorResponse(errors.New("payroll run not found")))
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("", summary))
+}
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"yc-backend/common"
+	"yc-backend/models"
+	"yc-backend/services"
+	"yc-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type PayScheduleRequest struct {
+	Rule       string `json:"rule" validate:"required"`
+	DayOfMonth int    `json:"dayOfMonth,omitempty"`
+	Hour       int    `json:"hour"`
+	Minute     int    `json:"minute"`
+	Timezone   string `json:"timezone,omitempty"`
+	Status     string `json:"status,omitempty"`
+}
+
+func (r PayScheduleRequest) validate() error {
+	switch r.Rule {
+	case models.PayDayLastBusinessDay:
+	case models.PayDayDayOfMonth:
+		if r.DayOfMonth < 1 || r.DayOfMonth > 31 {
+			return errors.New("dayOfMonth must be between 1 and 31")
+		}
+	default:
+		return fmt.Errorf("rule must be one of [%s, %s]", models.PayDayLastBusinessDay, models.PayDayDayOfMonth)
+	}
+	if r.Hour < 0 || r.Hour > 23 || r.Minute < 0 || r.Minute > 59 {
+		return errors.New("invalid payday time")
+	}
+	if r.Status != "" && r.Status != models.PayScheduleActive && r.Status != models.PaySchedulePaused {
+		return fmt.Errorf("invalid pay schedule status [%s]", r.Status)
+	}
+	if r.Timezone != "" {
+		if _, err := time.LoadLocation(r.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone [%s]", r.Timezone)
+		}
+	}
+	return nil
+}
+
+func UpsertPaySchedule(ctx *gin.Context) {
+	logger := common.LoggerFromCtx(ctx)
+	repo := common.ReposFromCtx(ctx)
+
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	var scheduleRequest PayScheduleRequest
+	if err := ctx.ShouldBindJSON(&scheduleRequest); err != nil {
+		logger.Errorf("bind request to PayScheduleRequest failed: %v", err)
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+	if err := scheduleRequest.validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	timeNow := time.Now()
+	schedule := models.PaySchedule{
+		UserID:     user.ID,
+		Rule:       scheduleRequest.Rule,
+		DayOfMonth: scheduleRequest.DayOfMonth,
+		Hour:       scheduleRequest.Hour,
+		Minute:     scheduleRequest.Minute,
+		Timezone:   scheduleRequest.Timezone,
+		Status:     scheduleRequest.Status,
+		UpdatedAt:  &timeNow,
+	}
+	if schedule.Timezone == "" {
+		schedule.Timezone = services.DefaultPayTimezone
+	}
+	if schedule.Status == "" {
+		schedule.Status = models.PayScheduleActive
+	}
+
+	nextRunAt, err := services.NextPayday(&schedule, timeNow)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+	schedule.NextRunAt = &nextRunAt
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	existing, err := repo.PaySchedule.FindOne(ctxWithTimeout, bson.D{{Key: "user_id", Value: user.ID}})
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		var id any
+		schedule.CreatedAt = &timeNow
+		id, err = repo.PaySchedule.Create(ctxWithTimeout, schedule)
+		if scheduleId, ok := id.(primitive.ObjectID); ok {
+			schedule.ID = scheduleId
+		}
+	case err == nil:
+		schedule.ID = existing.ID
+		err = repo.PaySchedule.UpdateOneById(ctxWithTimeout, existing.ID, schedule)
+	}
+	if err != nil {
+		logger.Errorf("Error occurred while saving pay schedule: %v", err)
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("pay schedule saved", schedule))
+}
+
+func GetPaySchedule(ctx *gin.Context) {
+	repo := common.ReposFromCtx(ctx)
+
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	schedule, err := repo.PaySchedule.FindOne(ctx, bson.D{{Key: "user_id", Value: user.ID}})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		ctx.JSON(http.StatusNotFound, utils.ErrorResponse(errors.New("no pay schedule configured")))
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("", schedule))
+}
+
+func ListPayScheduleExecutions(ctx *gin.Context) {
+	repo := common.ReposFromCtx(ctx)
+
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+
+	executions, err := repo.PayExecution.FindMany(ctx, bson.D{{Key: "user_id", Value: user.ID}})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("", executions))
+}
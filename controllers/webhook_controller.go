@@ -1,91 +1,214 @@
 package controllers
 
 import (
-	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"yc-backend/common"
 	"yc-backend/models"
+	"yc-backend/repository"
+	"yc-backend/services"
 	"yc-backend/utils"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var (
-	ProcessingEvent string = "PAYMENT.PROCESSING"
-	PendingEvent    string = "PAYMENT.PENDING"
-	FailedEvent     string = "PAYMENT.FAILED"
-	CompletedEvent  string = "PAYMENT.COMPLETE"
-)
+func YellowCardWebHook(ctx *gin.Context) {
+	logger := common.LoggerFromCtx(ctx)
 
-type Webhook struct {
-	ID         string `json:"id"`
-	SequenceID string `json:"sequenceId"`
-	Status     string `json:"status"`
-	ApiKey     string `json:"apiKey"`
-	Event      string `json:"event"`
-	ExecutedAt int64  `json:"executedAt"`
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		logger.Errorf("read webhook body failed: %v", err)
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	_, err = disbursementServiceFromCtx(ctx).ReceiveWebhook(ctx, services.WebhookDelivery{
+		Headers:        webhookHeaders(ctx.Request.Header),
+		Body:           body,
+		SignatureValid: validSignature(common.ConfigFromCtx(ctx), ctx.GetHeader("X-YC-Signature"), body),
+	})
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, services.ErrInvalidSignature), errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		logger.Errorf("webhook rejected: %v", err)
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	case errors.Is(err, mongo.ErrNoDocuments):
+		ctx.JSON(http.StatusNotFound, utils.ErrorResponse(errors.New("disbursement not found")))
+		return
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("", nil))
 }
 
-func YellowCardWebHook(ctx *gin.Context) {
-	repo := common.ReposFromCtx(ctx)
-	logger := common.LoggerFromCtx(ctx)
+// validSignature reports whether the signature is the base64 HMAC-SHA256 of
+// the body under the Yellow Card secret key.
+func validSignature(cfg *common.Config, receivedSignature string, body []byte) bool {
+	if receivedSignature == "" {
+		return false
+	}
+
+	h := hmac.New(sha256.New, []byte(cfg.YellowCardCredentials.SecretKey))
+	h.Write(body)
+	computedHash := h.Sum(nil)
+	computedSignature := base64.StdEncoding.EncodeToString(computedHash)
+	return hmac.Equal([]byte(receivedSignature), []byte(computedSignature))
+}
+
+func webhookHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+type ListWebhookEventsQuery struct {
+	EventID    string `form:"eventId"`
+	SequenceID string `form:"sequenceId"`
+	Status     string `form:"status"`
+	From       string `form:"from"`
+	To         string `form:"to"`
+	Order      string `form:"order"`
+	Limit      int64  `form:"limit"`
+	Cursor     string `form:"cursor"`
+}
+
+func (q ListWebhookEventsQuery) toFilter() (services.WebhookEventFilter, repository.PageQuery, error) {
+	var (
+		filter = services.WebhookEventFilter{EventID: q.EventID, SequenceID: q.SequenceID}
+		page   repository.PageQuery
+		err    error
+	)
+
+	if q.Status != "" {
+		for _, status := range strings.Split(q.Status, ",") {
+			filter.Statuses = append(filter.Statuses, strings.TrimSpace(status))
+		}
+	}
+	if filter.From, err = utils.ParseTime(q.From, false); err != nil {
+		return filter, page, err
+	}
+	if filter.To, err = utils.ParseTime(q.To, true); err != nil {
+		return filter, page, err
+	}
+	if q.Order != "" && q.Order != "asc" && q.Order != "desc" {
+		return filter, page, fmt.Errorf("invalid sort order [%s]", q.Order)
+	}
+
+	page = repository.PageQuery{
+		SortField: "received_at",
+		SortDesc:  q.Order != "asc",
+		Limit:     q.Limit,
+		Cursor:    q.Cursor,
+	}
+	return filter, page, nil
+}
 
-	if validateSignature(ctx) {
-		ctx.JSON(http.StatusBadRequest,
-			utils.ErrorResponse(errors.New("validating request to webhook payload failed")))
+// ListWebhookEvents lets admins inspect the webhooks Yellow Card sent.
+func ListWebhookEvents(ctx *gin.Context) {
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+	if !common.ConfigFromCtx(ctx).IsAdmin(user.Email) {
+		ctx.JSON(http.StatusForbidden, utils.ErrorResponse(errors.New("only admins can inspect webhook events")))
 		return
 	}
 
-	var hook Webhook
-	if err := ctx.ShouldBindJSON(&hook); err != nil {
-		logger.Errorf("bind request to webhook failed: %v", err)
+	var query ListWebhookEventsQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+	filter, page, err := query.toFilter()
+	if err != nil {
 		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
 		return
 	}
 
-	disbursement, err := repo.Disbursement.FindOne(ctx, primitive.D{{Key: "payment.sequenceid", Value: hook.SequenceID}})
+	events, err := disbursementServiceFromCtx(ctx).ListWebhookEvents(ctx, filter, page)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
 		return
 	}
 
-	switch hook.Event {
-	case PendingEvent,
-		ProcessingEvent,
-		CompletedEvent,
-		FailedEvent:
-		err = repo.Disbursement.UpdateOneById(ctx, disbursement.ID, models.Disbursement{Status: hook.Status})
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
-			return
-		}
-	default:
-	}
+	ctx.JSON(http.StatusOK, utils.SuccessResponse("", events))
+}
 
+type ReplayWebhooksRequest struct {
+	EventID    string `json:"eventId"`
+	SequenceID string `json:"sequenceId"`
+	From       string `json:"from"`
+	To         string `json:"to"`
 }
 
-func validateSignature(ctx *gin.Context) bool {
-	cfg := common.ConfigFromCtx(ctx)
-	receivedSignature := ctx.GetHeader("X-YC-Signature")
-	if receivedSignature == "" {
-		return false
+// ReplayWebhooks lets admins run stored webhook events through the webhook
+// handling again; with dryRun=true it only reports the status changes. With
+// force=true the statuses of the disbursements are rebuilt from all of their
+// stored events instead, even out of a terminal status.
+func ReplayWebhooks(ctx *gin.Context) {
+	user, ok := ctx.MustGet(common.UserKey).(*models.User)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(errors.New("internal server error")))
+		return
+	}
+	if !common.ConfigFromCtx(ctx).IsAdmin(user.Email) {
+		ctx.JSON(http.StatusForbidden, utils.ErrorResponse(errors.New("only admins can replay webhook events")))
+		return
 	}
 
-	body, err := io.ReadAll(ctx.Request.Body)
+	var request ReplayWebhooksRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+	filter := services.WebhookEventFilter{EventID: request.EventID, SequenceID: request.SequenceID}
+	var err error
+	if filter.From, err = utils.ParseTime(request.From, false); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+	if filter.To, err = utils.ParseTime(request.To, true); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
+
+	dryRun := ctx.Query("dryRun") == "true"
+	replay := disbursementServiceFromCtx(ctx).ReplayWebhooks
+	if ctx.Query("force") == "true" {
+		replay = disbursementServiceFromCtx(ctx).RebuildWebhookStatuses
+	}
+	report, err := replay(ctx, filter, dryRun)
+	if errors.Is(err, services.ErrReplayUnfiltered) {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorResponse(err))
+		return
+	}
 	if err != nil {
-		return false
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorResponse(err))
+		return
 	}
 
-	ctx.Request.Body = io.NopCloser(bytes.NewBuffer(body))
-	h := hmac.New(sha256.New, []byte(cfg.YellowCardCredentials.SecretKey))
-	h.Write(body)
-	computedHash := h.Sum(nil)
-	computedSignature := base64.StdEncoding.EncodeToString(computedHash)
-	return hmac.Equal([]byte(receivedSignature), []byte(computedSignature))
+	message := ""
+	if dryRun {
+		message = "dry run, nothing was applied"
+	}
+	ctx.JSON(http.StatusOK, utils.SuccessResponse(message, report))
 }
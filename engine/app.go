@@ -12,6 +12,8 @@ import (
 	"time"
 	"yc-backend/common"
 	"yc-backend/internals"
+	"yc-backend/repository"
+	"yc-backend/services"
 	"yc-backend/utils"
 
 	"github.com/gin-contrib/cors"
@@ -31,6 +33,9 @@ type Application struct {
 	mux  *gin.Engine
 	wg   sync.WaitGroup
 	quit chan os.Signal
+
+	jobsCtx  context.Context
+	stopJobs context.CancelFunc
 }
 
 func (srv *Application) Setup() *Application {
@@ -40,6 +45,7 @@ func (srv *Application) Setup() *Application {
 	r.Use(common.AddLoggerMiddleware(srv.Logger))
 	r.Use(common.AddConfigMiddleware(srv.Config))
 	r.Use(common.AddReposToMiddleware(srv.DB))
+	r.Use(common.AddJobsMiddleware(srv))
 	r.Use(gzip.Gzip(gzip.DefaultCompression))
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
@@ -50,9 +56,9 @@ func (srv *Application) Setup() *Application {
 		}
 		cors.New(cors.Config{
 			AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
-			AllowHeaders:     []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+			AllowHeaders:     []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", common.IdempotencyKeyHeader},
 			AllowCredentials: true,
-			ExposeHeaders:    []string{"Content-Length"},
+			ExposeHeaders:    []string{"Content-Length", common.IdempotentReplayedHeader},
 			AllowOriginFunc: func(origin string) bool {
 				return lo.Contains(cfg.AllowedCorsOrigin, origin)
 			},
@@ -77,9 +83,38 @@ func (srv *Application) Setup() *Application {
 
 	srv.quit = make(chan os.Signal, 1)
 	signal.Notify(srv.quit, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+
+	srv.startJobs()
 	return srv
 }
 
+// startJobs launches the background workers that run alongside the HTTP server.
+func (srv *Application) startJobs() {
+	repos := repository.InitRepositories(srv.DB.Database(srv.Config.MongoDB.DatabaseName))
+
+	indexCtx, cancel := context.WithTimeout(srv.Context, 10*time.Second)
+	defer cancel()
+	if err := repos.EnsureIndexes(indexCtx); err != nil {
+		srv.Logger.Errorf("could not create indexes: %v", err)
+	}
+
+	srv.jobsCtx, srv.stopJobs = context.WithCancel(srv.Context)
+
+	srv.Go(services.NewPayrollScheduler(srv.Config, repos, srv.Logger).Run)
+	srv.Go(services.NewReconciler(srv.Config, repos, srv.Logger).Run)
+	srv.Go(services.NewDisbursementService(srv.Config, repos, srv.Logger).ResumePayrollRuns)
+}
+
+// Go runs the job in the background on the jobs context; shutdown cancels it
+// and waits for it to return.
+func (srv *Application) Go(job func(context.Context)) {
+	srv.wg.Add(1)
+	go func() {
+		defer srv.wg.Done()
+		job(srv.jobsCtx)
+	}()
+}
+
 func (srv *Application) GracefulShutdown() {
 	go func(quit chan os.Signal, dbm *mongo.Client) {
 		<-quit
@@ -96,6 +131,8 @@ func (srv *Application) GracefulShutdown() {
 		if err != nil {
 			log.Fatal(err)
 		}
+		srv.stopJobs()
+		srv.wg.Wait()
 		err = dbm.Disconnect(shutdownCtx)
 		if err != nil {
 			log.Fatal(err)
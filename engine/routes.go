@@ -13,6 +13,13 @@ func (srv *Application) RegisterRoute() *Application {
 
 	r.POST("/webhook/yellow-card", controllers.YellowCardWebHook)
 
+	webhookRouter := r.Group("/webhooks")
+	webhookRouter.Use(common.AuthorizeUser())
+	{
+		webhookRouter.GET("/events", (controllers.ListWebhookEvents))
+		webhookRouter.POST("/replay", (controllers.ReplayWebhooks))
+	}
+
 	authorizedRouter := r.Group("/auth")
 	{
 		authorizedRouter.POST("/register", controllers.RegisterUser)
@@ -28,13 +35,66 @@ func (srv *Application) RegisterRoute() *Application {
 		managementRouter.POST("/", (controllers.AddEmployee))
 		managementRouter.PUT("/:employeeId", (controllers.UpdateEmployee))
 		managementRouter.DELETE("/:employeeId", (controllers.DeleteEmployee))
+		managementRouter.PUT("/:employeeId/pay-components", (controllers.UpdatePayComponents))
+		managementRouter.GET("/:employeeId/pay-breakdown", (controllers.GetPayBreakdown))
+		managementRouter.POST("/:employeeId/verify-account", (controllers.VerifyEmployeeAccount))
 	}
 
 	// include admin route check here
 	disbursementRouter := r.Group("/disbursements")
 	disbursementRouter.Use(common.AuthorizeUser())
 	{
-		disbursementRouter.POST("/:employeeId", (controllers.MakeDisbursmentToEmployee))
+		disbursementRouter.POST("/:id", common.Idempotent(), (controllers.MakeDisbursmentToEmployee))
+		disbursementRouter.POST("/:id/accept", (controllers.AcceptDisbursement))
+		disbursementRouter.POST("/:id/deny", (controllers.DenyDisbursement))
+		disbursementRouter.POST("/:id/off-cycle", common.Idempotent(), (controllers.MakeOffCyclePayment))
+		disbursementRouter.POST("/:id/retry", common.Idempotent(), (controllers.RetryDisbursement))
+		disbursementRouter.POST("/:id/approve", (controllers.ApproveDisbursement))
+		disbursementRouter.POST("/:id/reject", (controllers.RejectDisbursement))
+		disbursementRouter.GET("", (controllers.ListDisbursements))
+		disbursementRouter.GET("/estimate", (controllers.EstimateDisbursements))
+		disbursementRouter.GET("/:id", (controllers.GetDisbursement))
+		disbursementRouter.GET("/:id/history", (controllers.GetDisbursementHistory))
+		disbursementRouter.GET("/:id/payslip", (controllers.GetDisbursementPayslip))
+	}
+
+	payrollRouter := r.Group("/payroll-runs")
+	payrollRouter.Use(common.AuthorizeUser())
+	{
+		payrollRouter.POST("", common.Idempotent(), (controllers.CreatePayrollRun))
+		payrollRouter.GET("/:runId", (controllers.GetPayrollRun))
+		payrollRouter.POST("/:runId/approve", (controllers.ApprovePayrollRun))
+		payrollRouter.POST("/:runId/reject", (controllers.RejectPayrollRun))
+	}
+
+	approvalRouter := r.Group("/")
+	approvalRouter.Use(common.AuthorizeUser())
+	{
+		approvalRouter.PUT("/approval-policy", (controllers.UpsertApprovalPolicy))
+		approvalRouter.GET("/approval-policy", (controllers.GetApprovalPolicy))
+		approvalRouter.GET("/approvals", (controllers.ListPendingApprovals))
+	}
+
+	businessRouter := r.Group("/business")
+	businessRouter.Use(common.AuthorizeUser())
+	{
+		businessRouter.PUT("", (controllers.UpsertBusinessProfile))
+		businessRouter.GET("", (controllers.GetBusinessProfile))
+	}
+
+	limitsRouter := r.Group("/spending-limits")
+	limitsRouter.Use(common.AuthorizeUser())
+	{
+		limitsRouter.GET("", (controllers.GetSpendingLimits))
+		limitsRouter.PUT("", (controllers.UpdateSpendingLimits))
+	}
+
+	scheduleRouter := r.Group("/pay-schedule")
+	scheduleRouter.Use(common.AuthorizeUser())
+	{
+		scheduleRouter.PUT("", (controllers.UpsertPaySchedule))
+		scheduleRouter.GET("", (controllers.GetPaySchedule))
+		scheduleRouter.GET("/executions", (controllers.ListPayScheduleExecutions))
 	}
 
 	return srv
@@ -2,13 +2,17 @@ module yc-backend
 
 go 1.22.3
 
-require github.com/gookit/config/v2 v2.2.5
+require (
+	github.com/go-pdf/fpdf v0.9.0
+	github.com/gookit/config/v2 v2.2.5
+)
 
 require (
 	github.com/bytedance/sonic v1.11.6 // indirect
 	github.com/bytedance/sonic/loader v0.1.1 // indirect
 	github.com/cloudwego/base64x v0.1.4 // indirect
 	github.com/cloudwego/iasm v0.2.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fatih/color v1.14.1 // indirect
 	github.com/gabriel-vasile/mimetype v1.4.3 // indirect
 	github.com/gin-contrib/gzip v1.0.1 // indirect
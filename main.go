@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log"
+	"os"
 	"time"
 	"yc-backend/common"
 	"yc-backend/engine"
@@ -19,6 +20,12 @@ func main() {
 		log.Fatal(err)
 	}
 	logger := internals.GetLogger()
+	if len(os.Args) > 1 && os.Args[1] == "replay-webhooks" {
+		if err := replayWebhooks(config, logger, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	serverCtx, serverStopCtx := context.WithCancel(context.Background())
 	defer serverStopCtx()
 	if config.LogLevel == "debug" {
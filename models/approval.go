@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
+// ApprovalPolicy decides which disbursements of a business need a second user
+// to approve them before any money moves.
+type ApprovalPolicy struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" validate:"required"`
+	UserID primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty" validate:"required"`
+	// Enabled and RequireForPayrollRuns are stored without omitempty so that
+	// saving the policy can switch them off.
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Threshold is the amount in USD above which a disbursement needs
+	// approval; zero means every disbursement does.
+	Threshold             float64              `bson:"threshold" json:"threshold"`
+	RequireForPayrollRuns bool                 `bson:"require_for_payroll_runs" json:"requireForPayrollRuns"`
+	Approvers             []primitive.ObjectID `bson:"approvers" json:"approvers"`
+	CreatedAt             *time.Time           `bson:"createdAt,omitempty" json:"-" validate:"required"`
+	UpdatedAt             *time.Time           `bson:"updatedAt,omitempty" json:"-" validate:"required"`
+}
+
+// ApprovalDecision is an approver's decision on a disbursement.
+type ApprovalDecision struct {
+	ApproverID primitive.ObjectID `bson:"approver_id" json:"approver_id"`
+	Decision   string             `bson:"decision" json:"decision"`
+	Comment    string             `bson:"comment,omitempty" json:"comment,omitempty"`
+	DecidedAt  time.Time          `bson:"decided_at" json:"decided_at"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Business is the registered business a user disburses salaries for. Its
+// details are sent to Yellow Card as the sender of every payment.
+type Business struct {
+	ID                 primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" validate:"required"`
+	UserID             primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty" validate:"required"`
+	RegisteredName     string             `bson:"registered_name,omitempty" json:"registeredName,omitempty" validate:"required"`
+	RegistrationNumber string             `bson:"registration_number,omitempty" json:"registrationNumber,omitempty" validate:"required"`
+	TaxID              string             `bson:"tax_id,omitempty" json:"taxId,omitempty"`
+	BusinessType       string             `bson:"business_type,omitempty" json:"businessType,omitempty"`
+	IncorporatedOn     string             `bson:"incorporated_on,omitempty" json:"incorporatedOn,omitempty"`
+	Address            string             `bson:"address,omitempty" json:"address,omitempty" validate:"required"`
+	City               string             `bson:"city,omitempty" json:"city,omitempty"`
+	Country            string             `bson:"country,omitempty" json:"country,omitempty" validate:"required"`
+	Email              string             `bson:"email,omitempty" json:"email,omitempty" validate:"required,email"`
+	Phone              string             `bson:"phone,omitempty" json:"phone,omitempty" validate:"required"`
+	Website            string             `bson:"website,omitempty" json:"website,omitempty"`
+	CreatedAt          *time.Time         `bson:"createdAt,omitempty" json:"-" validate:"required"`
+	UpdatedAt          *time.Time         `bson:"updatedAt,omitempty" json:"-" validate:"required"`
+}
+
+// MissingFields lists the details Yellow Card needs about the business that
+// are not filled in.
+func (b *Business) MissingFields() []string {
+	missing := []string{}
+	for _, field := range []struct {
+		name  string
+		value string
+	}{
+		{"registeredName", b.RegisteredName},
+		{"registrationNumber", b.RegistrationNumber},
+		{"address", b.Address},
+		{"country", b.Country},
+		{"email", b.Email},
+		{"phone", b.Phone},
+	} {
+		if field.value == "" {
+			missing = append(missing, field.name)
+		}
+	}
+	return missing
+}
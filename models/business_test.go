@@ -0,0 +1,22 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/gookit/goutil/testutil/assert"
+)
+
+func TestBusinessMissingFields(t *testing.T) {
+	business := Business{
+		RegisteredName: "Acme Payroll Ltd",
+		Address:        "1 Marina, Lagos",
+		Country:        "NG",
+		Email:          "finance@acme.ng",
+	}
+
+	assert.Equal(t, []string{"registrationNumber", "phone"}, business.MissingFields())
+
+	business.RegistrationNumber = "RC1234567"
+	business.Phone = "+2348012345678"
+	assert.Empty(t, business.MissingFields())
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"github.com/samber/lo"
+)
+
+type DisbursementStatus string
+
+const (
+	DisbursementAwaitingApproval DisbursementStatus = "awaiting_approval"
+	DisbursementRejected         DisbursementStatus = "rejected"
+	// DisbursementCreated is a disbursement ready to be submitted to Yellow Card.
+	DisbursementCreated    DisbursementStatus = "created"
+	DisbursementQuoted     DisbursementStatus = "quoted"
+	DisbursementPending    DisbursementStatus = "pending"
+	DisbursementProcessing DisbursementStatus = "processing"
+	DisbursementCompleted  DisbursementStatus = "completed"
+	DisbursementFailed     DisbursementStatus = "failed"
+	DisbursementDenied     DisbursementStatus = "denied"
+	DisbursementExpired    DisbursementStatus = "expired"
+)
+
+const (
+	StatusSourceAPI     = "api"
+	StatusSourceWebhook = "webhook"
+	StatusSourcePoller  = "poller"
+	// StatusSourceReplay marks statuses an admin rebuilt from stored webhook events.
+	StatusSourceReplay = "replay"
+)
+
+// disbursementTransitions lists the statuses a disbursement may move to from each
+// status. Terminal statuses have no outgoing transitions, so late or out-of-order
+// events can never move a finished payment backwards.
+var disbursementTransitions = map[DisbursementStatus][]DisbursementStatus{
+	DisbursementAwaitingApproval: {
+		DisbursementCreated,
+		DisbursementRejected,
+	},
+	DisbursementCreated: {
+		DisbursementQuoted,
+		DisbursementPending,
+		DisbursementProcessing,
+		DisbursementCompleted,
+		DisbursementFailed,
+	},
+	DisbursementQuoted: {
+		DisbursementPending,
+		DisbursementProcessing,
+		DisbursementCompleted,
+		DisbursementFailed,
+		DisbursementDenied,
+		DisbursementExpired,
+	},
+	DisbursementPending: {
+		DisbursementProcessing,
+		DisbursementCompleted,
+		DisbursementFailed,
+	},
+	DisbursementProcessing: {
+		DisbursementCompleted,
+		DisbursementFailed,
+	},
+	DisbursementCompleted: {},
+	DisbursementFailed:    {},
+	DisbursementDenied:    {},
+	DisbursementExpired:   {},
+	DisbursementRejected:  {},
+}
+
+// CanTransitionTo reports whether moving from s to next is allowed.
+func (s DisbursementStatus) CanTransitionTo(next DisbursementStatus) bool {
+	return lo.Contains(disbursementTransitions[s], next)
+}
+
+// IsTerminal reports whether no further status change is possible.
+func (s DisbursementStatus) IsTerminal() bool {
+	next, ok := disbursementTransitions[s]
+	return ok && len(next) == 0
+}
+
+// StatusChange is an append-only entry in a disbursement's status history.
+type StatusChange struct {
+	Status    DisbursementStatus `bson:"status" json:"status"`
+	Source    string             `bson:"source" json:"source"`
+	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
+	EventID   string             `bson:"event_id,omitempty" json:"event_id,omitempty"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/gookit/goutil/testutil/assert"
+)
+
+func TestDisbursementStatusTransitions(t *testing.T) {
+	assert.True(t, DisbursementQuoted.CanTransitionTo(DisbursementProcessing))
+	assert.True(t, DisbursementPending.CanTransitionTo(DisbursementProcessing))
+	assert.True(t, DisbursementProcessing.CanTransitionTo(DisbursementCompleted))
+
+	// out-of-order webhooks must not move a payment backwards
+	assert.False(t, DisbursementProcessing.CanTransitionTo(DisbursementPending))
+	assert.False(t, DisbursementCompleted.CanTransitionTo(DisbursementProcessing))
+	assert.False(t, DisbursementFailed.CanTransitionTo(DisbursementCompleted))
+}
+
+func TestDisbursementStatusIsTerminal(t *testing.T) {
+	for _, status := range []DisbursementStatus{DisbursementCompleted, DisbursementFailed, DisbursementDenied, DisbursementExpired} {
+		assert.True(t, status.IsTerminal(), string(status))
+	}
+	for _, status := range []DisbursementStatus{DisbursementQuoted, DisbursementPending, DisbursementProcessing, "unknown"} {
+		assert.False(t, status.IsTerminal(), string(status))
+	}
+}
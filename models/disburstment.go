@@ -6,15 +6,32 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Yellow Card payment webhook events
+const (
+	PaymentProcessingEvent = "PAYMENT.PROCESSING"
+	PaymentPendingEvent    = "PAYMENT.PENDING"
+	PaymentFailedEvent     = "PAYMENT.FAILED"
+	PaymentCompletedEvent  = "PAYMENT.COMPLETE"
+)
+
+// CustomerTypeInstitution is the Yellow Card customer type of payments sent by
+// a business rather than a person; it requires the sender's businessId and
+// businessName.
+const CustomerTypeInstitution = "institution"
+
 type Sender struct {
-	Name     string `json:"name"`
-	Country  string `json:"country"`
-	Phone    string `json:"phone"`
-	Address  string `json:"address"`
-	DOB      string `json:"dob"`
-	Email    string `json:"email"`
-	IDNumber string `json:"idNumber"`
-	IDType   string `json:"idType"`
+	Name               string `json:"name"`
+	Country            string `json:"country"`
+	Phone              string `json:"phone"`
+	Address            string `json:"address"`
+	DOB                string `json:"dob"`
+	Email              string `json:"email"`
+	IDNumber           string `json:"idNumber"`
+	IDType             string `json:"idType"`
+	BusinessID         string `json:"businessId,omitempty"`
+	BusinessName       string `json:"businessName,omitempty"`
+	AdditionalIDType   string `json:"additionalIdType,omitempty"`
+	AdditionalIDNumber string `json:"additionalIdNumber,omitempty"`
 }
 
 type Destination struct {
@@ -22,6 +39,23 @@ type Destination struct {
 	AccountNumber string `json:"accountNumber"`
 	AccountType   string `json:"accountType"`
 	NetworkID     string `json:"networkId"`
+	AccountBank   string `json:"accountBank,omitempty"`
+	NetworkName   string `json:"networkName,omitempty"`
+	Country       string `json:"country,omitempty"`
+	PhoneNumber   string `json:"phoneNumber,omitempty"`
+}
+
+// PaymentRequest is the body sent to Yellow Card to submit a payment. It is
+// stored on the disbursement so it can be submitted after approval.
+type PaymentRequest struct {
+	ChannelID    string      `json:"channelId"`
+	SequenceID   string      `json:"sequenceId"`
+	LocalAmount  float64     `json:"localAmount"`
+	Reason       string      `json:"reason"`
+	Sender       Sender      `json:"sender"`
+	Destination  Destination `json:"destination"`
+	ForceAccept  bool        `json:"forceAccept"`
+	CustomerType string      `json:"customerType"`
 }
 
 type Payment struct {
@@ -40,6 +74,13 @@ type Payment struct {
 	CreatedAt       string      `json:"createdAt"`
 	UpdatedAt       string      `json:"updatedAt"`
 	ExpiresAt       string      `json:"expiresAt"`
+	ErrorCode       string      `json:"errorCode,omitempty"`
+}
+
+// IsZero lets the bson encoder honour omitempty on Payment, so partial updates
+// of a disbursement do not overwrite the stored payment with an empty one.
+func (p Payment) IsZero() bool {
+	return p.ID == "" && p.SequenceID == ""
 }
 
 type Disbursement struct {
@@ -48,7 +89,36 @@ type Disbursement struct {
 	CreatedAt    *time.Time         `bson:"createdAt,omitempty" json:"-" validate:"required"`
 	UpdatedAt    *time.Time         `bson:"updatedAt,omitempty" json:"-" validate:"required"`
 	SalaryAmount float64            `bson:"salary_amount,omitempty" json:"salary_amount,omitempty" validate:"required"`
-	SenderID     primitive.ObjectID `bson:"sender_id,omitempty" json:"sender_id,omitempty" validate:"required"`
-	Status       string             `bson:"status,omitempty" json:"status,omitempty" validate:"required"`
-	Payment      Payment            `bson:"payment,omitempty" json:"payment,omitempty" validate:"required"`
+	PaymentType  string             `bson:"payment_type,omitempty" json:"payment_type,omitempty"`
+	Note         string             `bson:"note,omitempty" json:"note,omitempty"`
+	Currency     string             `bson:"currency,omitempty" json:"currency,omitempty"`
+	Breakdown    *PayBreakdown      `bson:"breakdown,omitempty" json:"breakdown,omitempty"`
+	AppliedRate  *AppliedRate       `bson:"applied_rate,omitempty" json:"applied_rate,omitempty"`
+	// AmountUSD is SalaryAmount at the Yellow Card rate of the day it was
+	// created, which spending limits are counted in. It is zero when there was
+	// no rate for the currency.
+	AmountUSD      float64            `bson:"amount_usd,omitempty" json:"amount_usd,omitempty"`
+	SenderID       primitive.ObjectID `bson:"sender_id,omitempty" json:"sender_id,omitempty" validate:"required"`
+	Status         DisbursementStatus `bson:"status,omitempty" json:"status,omitempty" validate:"required"`
+	StatusHistory  []StatusChange     `bson:"status_history,omitempty" json:"status_history,omitempty"`
+	Payment        Payment            `bson:"payment,omitempty" json:"payment,omitempty" validate:"required"`
+	PaymentRequest *PaymentRequest    `bson:"payment_request,omitempty" json:"payment_request,omitempty"`
+	InitiatedBy    primitive.ObjectID `bson:"initiated_by,omitempty" json:"initiated_by,omitempty"`
+	Approvals      []ApprovalDecision `bson:"approvals,omitempty" json:"approvals,omitempty"`
+	PayrollRunID   primitive.ObjectID `bson:"payroll_run_id,omitempty" json:"payroll_run_id,omitempty"`
+	Attempt        int                `bson:"attempt,omitempty" json:"attempt,omitempty"`
+	RetryOf        primitive.ObjectID `bson:"retry_of,omitempty" json:"retry_of,omitempty"`
+	RetriedBy      primitive.ObjectID `bson:"retried_by,omitempty" json:"retried_by,omitempty"`
+	FailureReason  string             `bson:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+	NextRetryAt    *time.Time         `bson:"next_retry_at,omitempty" json:"next_retry_at,omitempty"`
+	// SplitAmounts are the payments a disbursement above the channel maximum is
+	// made in. Each is submitted as a part, a child disbursement with ParentID
+	// set, and the disbursement completes once all its parts complete.
+	SplitAmounts []float64          `bson:"split_amounts,omitempty" json:"split_amounts,omitempty"`
+	ParentID     primitive.ObjectID `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
+	Part         int                `bson:"part,omitempty" json:"part,omitempty"`
+	// Parts are the latest attempts of the parts, loaded on request.
+	Parts []Disbursement `bson:"-" json:"parts,omitempty"`
+	// LimitsOverriddenBy is the admin who let the disbursement exceed the spending limits.
+	LimitsOverriddenBy primitive.ObjectID `bson:"limits_overridden_by,omitempty" json:"limits_overridden_by,omitempty"`
 }
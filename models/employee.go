@@ -9,6 +9,19 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	EmployeeActive   = "active"
+	EmployeeInactive = "inactive"
+
+	// payout methods, stored in Employee.AccountType
+	PayoutBank = "bank"
+	PayoutMomo = "momo"
+
+	AccountVerified     = "verified"
+	AccountNameMismatch = "name_mismatch"
+	AccountUnresolved   = "unresolved"
+)
+
 var (
 	employeeOmitList = []string{
 		"CreatedAt",
@@ -16,6 +29,9 @@ var (
 	}
 )
 
+// Employee is a member of staff of a business. AccountType is the payout
+// method; for mobile money AccountNumber is the wallet's phone number and
+// BankName the mobile money operator.
 type Employee struct {
 	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" validate:"required"`
 	FirstName        string             `bson:"firstName,omitempty" json:"firstName,omitempty" validate:"required"`
@@ -35,8 +51,26 @@ type Employee struct {
 	Salary           float64            `bson:"salary,omitempty" json:"salary,omitempty" validate:"required"`
 	UserID           primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty" validate:"required"`
 	AccountName      string             `bson:"account_name,omitempty" json:"account_name,omitempty" validate:"required"`
+	AccountNumber    string             `bson:"account_number,omitempty" json:"account_number,omitempty" validate:"required"`
 	AccountType      string             `bson:"account_type,omitempty" json:"account_type,omitempty" validate:"required"`
 	BankName         string             `bson:"bank_name,omitempty" json:"bank_name,omitempty" validate:"required"`
+	NetworkID        string             `bson:"network_id,omitempty" json:"network_id,omitempty"`
+	Currency         string             `bson:"currency,omitempty" json:"currency,omitempty"`               // payout currency, defaults to the channel currency of Country
+	SalaryCurrency   string             `bson:"salary_currency,omitempty" json:"salary_currency,omitempty"` // USD, or empty when the salary is in the payout currency
+	Status           string             `bson:"status,omitempty" json:"status,omitempty"`
+	PayComponents    *PayComponents     `bson:"pay_components,omitempty" json:"pay_components,omitempty"`
+
+	AccountVerification *AccountVerification `bson:"account_verification,omitempty" json:"account_verification,omitempty"`
+}
+
+// AccountVerification records whether the holder of the employee's account,
+// as resolved by Yellow Card, is the employee.
+type AccountVerification struct {
+	Status       string    `bson:"status" json:"status"`
+	ResolvedName string    `bson:"resolved_name,omitempty" json:"resolved_name,omitempty"`
+	Score        float64   `bson:"score" json:"score"`
+	Reason       string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	CheckedAt    time.Time `bson:"checked_at" json:"checked_at"`
 }
 
 func (e *Employee) Omit() (Employee, error) {
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IdempotencyKeyTTL is how long an Idempotency-Key is kept; the key can be
+// reused once it expires.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// IdempotencyRecord stores the outcome of a request made with an Idempotency-Key
+// so that retries of the same request replay the original response.
+type IdempotencyRecord struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" validate:"required"`
+	UserID      primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty" validate:"required"`
+	Key         string             `bson:"key,omitempty" json:"key,omitempty" validate:"required"`
+	Method      string             `bson:"method,omitempty" json:"method,omitempty"`
+	Path        string             `bson:"path,omitempty" json:"path,omitempty"`
+	RequestHash string             `bson:"request_hash,omitempty" json:"request_hash,omitempty" validate:"required"`
+	StatusCode  int                `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Response    string             `bson:"response,omitempty" json:"response,omitempty"`
+	CreatedAt   *time.Time         `bson:"createdAt,omitempty" json:"-" validate:"required"`
+	CompletedAt *time.Time         `bson:"completedAt,omitempty" json:"-"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// PayItem is a named amount on a payslip, such as an allowance or a deduction.
+type PayItem struct {
+	Name   string  `bson:"name" json:"name"`
+	Amount float64 `bson:"amount" json:"amount"`
+}
+
+// PayComponents is the monthly salary structure of an employee.
+type PayComponents struct {
+	Basic           float64   `bson:"basic" json:"basic"`
+	Housing         float64   `bson:"housing,omitempty" json:"housing,omitempty"`
+	Transport       float64   `bson:"transport,omitempty" json:"transport,omitempty"`
+	OtherAllowances []PayItem `bson:"other_allowances,omitempty" json:"otherAllowances,omitempty"`
+	// Pension rates are percentages of basic, housing and transport. Zero
+	// means the statutory default applies.
+	PensionEmployeeRate float64   `bson:"pension_employee_rate,omitempty" json:"pensionEmployeeRate,omitempty"`
+	PensionEmployerRate float64   `bson:"pension_employer_rate,omitempty" json:"pensionEmployerRate,omitempty"`
+	PensionExempt       bool      `bson:"pension_exempt,omitempty" json:"pensionExempt,omitempty"`
+	TaxExempt           bool      `bson:"tax_exempt,omitempty" json:"taxExempt,omitempty"`
+	Deductions          []PayItem `bson:"deductions,omitempty" json:"deductions,omitempty"`
+}
+
+// PayBreakdown is the result of computing an employee's monthly pay from gross to net.
+type PayBreakdown struct {
+	Earnings        []PayItem `bson:"earnings,omitempty" json:"earnings,omitempty"`
+	Gross           float64   `bson:"gross" json:"gross"`
+	PensionEmployee float64   `bson:"pension_employee,omitempty" json:"pensionEmployee"`
+	PensionEmployer float64   `bson:"pension_employer,omitempty" json:"pensionEmployer"`
+	PAYE            float64   `bson:"paye,omitempty" json:"paye"`
+	Deductions      []PayItem `bson:"deductions,omitempty" json:"deductions,omitempty"`
+	TotalDeductions float64   `bson:"total_deductions,omitempty" json:"totalDeductions"`
+	Net             float64   `bson:"net" json:"net"`
+}
+
+// AppliedRate is the exchange rate a salary was converted at before it was paid.
+type AppliedRate struct {
+	From      string    `bson:"from" json:"from"`
+	To        string    `bson:"to" json:"to"`
+	Rate      float64   `bson:"rate" json:"rate"`
+	RateID    string    `bson:"rate_id,omitempty" json:"rate_id,omitempty"`
+	AppliedAt time.Time `bson:"applied_at" json:"applied_at"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	PayDayLastBusinessDay = "last_business_day"
+	PayDayDayOfMonth      = "day_of_month"
+
+	PayScheduleActive = "active"
+	PaySchedulePaused = "paused"
+
+	PayScheduleExecutionRunning   = "running"
+	PayScheduleExecutionCompleted = "completed"
+	PayScheduleExecutionFailed    = "failed"
+)
+
+// PaySchedule describes when payroll runs automatically for a business.
+type PaySchedule struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" validate:"required"`
+	UserID     primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty" validate:"required"`
+	Rule       string             `bson:"rule,omitempty" json:"rule,omitempty" validate:"required"`
+	DayOfMonth int                `bson:"day_of_month,omitempty" json:"day_of_month,omitempty"`
+	Hour       int                `bson:"hour,omitempty" json:"hour"`
+	Minute     int                `bson:"minute,omitempty" json:"minute"`
+	Timezone   string             `bson:"timezone,omitempty" json:"timezone,omitempty" validate:"required"`
+	Status     string             `bson:"status,omitempty" json:"status,omitempty" validate:"required"`
+	NextRunAt  *time.Time         `bson:"next_run_at,omitempty" json:"next_run_at,omitempty"`
+	LastRunAt  *time.Time         `bson:"last_run_at,omitempty" json:"last_run_at,omitempty"`
+	CreatedAt  *time.Time         `bson:"createdAt,omitempty" json:"-" validate:"required"`
+	UpdatedAt  *time.Time         `bson:"updatedAt,omitempty" json:"-" validate:"required"`
+}
+
+// PayScheduleExecution records a single scheduled payroll so that a payday is
+// never executed twice and missed paydays can be detected.
+type PayScheduleExecution struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty" validate:"required"`
+	ScheduleID   primitive.ObjectID `bson:"schedule_id,omitempty" json:"schedule_id,omitempty" validate:"required"`
+	UserID       primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty" validate:"required"`
+	ScheduledFor *time.Time         `bson:"scheduled_for,omitempty" json:"scheduled_for,omitempty" validate:"required"`
+	CatchUp      bool               `bson:"catch_up,omitempty" json:"catch_up,omitempty"`
+	Status       string             `bson:"status,omitempty" json:"status,omitempty" validate:"required"`
+	PayrollRunID primitive.ObjectID `bson:"payroll_run_id,omitempty" json:"payroll_run_id,omitempty"`
+	Error        string             `bson:"error,omitempty" json:"error,omitempty"`
+	StartedAt    *time.Time         `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	FinishedAt   *time.Time         `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
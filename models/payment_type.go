@@ -0,0 +1,26 @@
+package models
+
+const (
+	PaymentTypeSalary        = "salary"
+	PaymentTypeBonus         = "bonus"
+	PaymentTypeReimbursement = "reimbursement"
+	PaymentTypeArrears       = "arrears"
+)
+
+// OffCyclePaymentTypes are the payments that can be made outside a payroll.
+var OffCyclePaymentTypes = []string{PaymentTypeBonus, PaymentTypeReimbursement, PaymentTypeArrears}
+
+// DefaultPaymentReason is sent when no reason is given; Yellow Card rejects
+// reasons outside PaymentReasons.
+const DefaultPaymentReason = "other"
+
+// PaymentReasons is the catalog of payment reasons Yellow Card accepts.
+var PaymentReasons = []string{
+	"bills",
+	"education",
+	"entertainment",
+	"family",
+	"gifts",
+	"groceries",
+	"other",
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	PayrollRunRunning   = "running"
+	PayrollRunSubmitted = "submitted"
+	PayrollRunFailed    = "failed"
+)
+
+type PayrollRunFailure struct {
+	EmployeeID primitive.ObjectID `bson:"employee_id,omitempty" json:"employee_id,omitempty"`
+	Error      string             `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+type PayrollRun struct {
+	ID            primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty" validate:"required"`
+	UserID        primitive.ObjectID  `bson:"user_id,omitempty" json:"user_id,omitempty" validate:"required"`
+	Status        string              `bson:"status,omitempty" json:"status,omitempty" validate:"required"`
+	EmployeeCount int                 `bson:"employee_count,omitempty" json:"employee_count"`
+	Failures      []PayrollRunFailure `bson:"failures,omitempty" json:"failures,omitempty"`
+	CreatedAt     *time.Time          `bson:"createdAt,omitempty" json:"createdAt,omitempty" validate:"required"`
+	UpdatedAt     *time.Time          `bson:"updatedAt,omitempty" json:"-" validate:"required"`
+	CompletedAt   *time.Time          `bson:"completedAt,omitempty" json:"completedAt,omitempty"`
+}
+
+// Payroll work item statuses. An item is marked submitted right before its
+// payment is sent to Yellow Card, so an item left submitted by a crash is the
+// only one whose payment may or may not have reached Yellow Card.
+const (
+	WorkItemPending   = "pending"
+	WorkItemSubmitted = "submitted"
+	WorkItemConfirmed = "confirmed"
+	WorkItemFailed    = "failed"
+)
+
+// PayrollWorkItem is the checkpoint of paying one employee of a payroll run.
+// The disbursement id and sequenceId are reserved when the run is created, so
+// a resumed run pays the employee with the same ones.
+type PayrollWorkItem struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	RunID          primitive.ObjectID `bson:"run_id,omitempty" json:"run_id,omitempty"`
+	EmployeeID     primitive.ObjectID `bson:"employee_id,omitempty" json:"employee_id,omitempty"`
+	DisbursementID primitive.ObjectID `bson:"disbursement_id,omitempty" json:"disbursement_id,omitempty"`
+	SequenceID     string             `bson:"sequence_id,omitempty" json:"sequence_id,omitempty"`
+	Status         string             `bson:"status,omitempty" json:"status,omitempty"`
+	Error          string             `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt      *time.Time         `bson:"createdAt,omitempty" json:"-"`
+	UpdatedAt      *time.Time         `bson:"updatedAt,omitempty" json:"-"`
+}
+
+// PayrollRunSummary aggregates the state of every disbursement linked to a run.
+type PayrollRunSummary struct {
+	Run              PayrollRun `json:"run"`
+	Submitted        int        `json:"submitted"`
+	AwaitingApproval int        `json:"awaitingApproval"`
+	Processing       int        `json:"processing"`
+	Completed        int        `json:"completed"`
+	Failed           int        `json:"failed"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SpendingCounter tallies in USD what a business, or an employee, has been
+// disbursed in one day or month. Disbursements reserve their amount on the
+// counters before they are created, so the limits hold across processes.
+type SpendingCounter struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Scope       string             `bson:"scope" json:"scope"`
+	OwnerID     primitive.ObjectID `bson:"owner_id" json:"ownerId"`
+	Period      string             `bson:"period" json:"period"`
+	PeriodStart time.Time          `bson:"period_start" json:"periodStart"`
+	Spent       float64            `bson:"spent" json:"spent"`
+	CreatedAt   *time.Time         `bson:"createdAt,omitempty" json:"-"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SpendingLimits caps how much can be disbursed, in USD whatever the payout
+// currency; a zero amount means no limit.
+type SpendingLimits struct {
+	PerTransaction float64 `bson:"per_transaction" json:"perTransaction" config:"perTransaction"`
+	Daily          float64 `bson:"daily" json:"daily" config:"daily"`
+	Monthly        float64 `bson:"monthly" json:"monthly" config:"monthly"`
+}
+
+// EmployeeSpendingLimits overrides the default employee limits for one employee.
+type EmployeeSpendingLimits struct {
+	EmployeeID primitive.ObjectID `bson:"employee_id" json:"employeeId"`
+	Limits     SpendingLimits     `bson:"limits" json:"limits"`
+}
+
+// SpendingLimitPolicy holds the limits of a business: Business applies to all
+// of its disbursements together, Employee to the disbursements of each
+// employee unless the employee has an override in Employees.
+type SpendingLimitPolicy struct {
+	ID        primitive.ObjectID       `bson:"_id,omitempty" json:"id,omitempty" validate:"required"`
+	UserID    primitive.ObjectID       `bson:"user_id,omitempty" json:"user_id,omitempty" validate:"required"`
+	Business  SpendingLimits           `bson:"business" json:"business"`
+	Employee  SpendingLimits           `bson:"employee" json:"employee"`
+	Employees []EmployeeSpendingLimits `bson:"employees" json:"employees"`
+	CreatedAt *time.Time               `bson:"createdAt,omitempty" json:"-" validate:"required"`
+	UpdatedAt *time.Time               `bson:"updatedAt,omitempty" json:"-" validate:"required"`
+}
+
+// EmployeeLimits returns the limits that apply to the employee.
+func (p SpendingLimitPolicy) EmployeeLimits(employeeID primitive.ObjectID) SpendingLimits {
+	for _, override := range p.Employees {
+		if override.EmployeeID == employeeID {
+			return override.Limits
+		}
+	}
+	return p.Employee
+}
+
+// Within reports whether every limit is at least as strict as its counterpart
+// in other.
+func (l SpendingLimits) Within(other SpendingLimits) bool {
+	within := func(limit, otherLimit float64) bool {
+		return otherLimit == 0 || (limit > 0 && limit <= otherLimit)
+	}
+	return within(l.PerTransaction, other.PerTransaction) &&
+		within(l.Daily, other.Daily) &&
+		within(l.Monthly, other.Monthly)
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook event processing outcomes
+const (
+	WebhookEventReceived  = "received"
+	WebhookEventProcessed = "processed"
+	WebhookEventIgnored   = "ignored"
+	WebhookEventRejected  = "rejected"
+	WebhookEventFailed    = "failed"
+)
+
+// WebhookEvent is a webhook delivered by Yellow Card, stored as it was received
+// together with the outcome of processing it. Redeliveries of the same event id
+// are counted on the first delivery rather than stored again.
+type WebhookEvent struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	EventID        string             `bson:"event_id,omitempty" json:"event_id,omitempty"`
+	Event          string             `bson:"event,omitempty" json:"event,omitempty"`
+	SequenceID     string             `bson:"sequence_id,omitempty" json:"sequence_id,omitempty"`
+	Headers        map[string]string  `bson:"headers,omitempty" json:"headers,omitempty"`
+	Body           string             `bson:"body" json:"body"`
+	SignatureValid bool               `bson:"signature_valid" json:"signature_valid"`
+	Status         string             `bson:"status,omitempty" json:"status,omitempty"`
+	Error          string             `bson:"error,omitempty" json:"error,omitempty"`
+	Deliveries     int                `bson:"deliveries,omitempty" json:"deliveries,omitempty"`
+	ReceivedAt     *time.Time         `bson:"received_at,omitempty" json:"received_at,omitempty"`
+	LastReceivedAt *time.Time         `bson:"last_received_at,omitempty" json:"last_received_at,omitempty"`
+	ProcessedAt    *time.Time         `bson:"processed_at,omitempty" json:"processed_at,omitempty"`
+	Replays        int                `bson:"replays,omitempty" json:"replays,omitempty"`
+	LastReplayedAt *time.Time         `bson:"last_replayed_at,omitempty" json:"last_replayed_at,omitempty"`
+}
@@ -1,21 +1,54 @@
 package pkg
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strings"
 	"time"
+	"yc-backend/models"
 	"yc-backend/utils"
 
 	"github.com/samber/lo"
 )
 
+var ErrPaymentNotFound = errors.New("payment not found")
+
+// APIError is a response Yellow Card answered with an unsuccessful status.
+type APIError struct {
+	StatusCode int
+	Status     string
+	// Code is the Yellow Card error code in the response body, if any.
+	Code string
+	Body string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("failed to submit payment = %v , code = %v", e.Body, e.Status)
+}
+
+// IsRejection reports whether Yellow Card definitely refused the request: a
+// client error other than a timeout, a conflict or rate limiting, none of which
+// say the request was not acted on.
+func IsRejection(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return false
+	}
+	return apiErr.StatusCode >= 400 && apiErr.StatusCode < 500
+}
+
 type Channel struct {
 	ID                      string    `json:"id"`
 	Max                     float64   `json:"max"`
@@ -64,6 +97,12 @@ type Rate struct {
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
+type ResolvedAccount struct {
+	AccountNumber string `json:"accountNumber"`
+	AccountName   string `json:"accountName"`
+	AccountBank   string `json:"accountBank"`
+}
+
 type ChannelResponse struct {
 	Channels []Channel `json:"channels"`
 }
@@ -89,7 +128,15 @@ type YellowClient struct {
 // NewYellowClient constructor
 func NewYellowClient(baseUrl, apiKey, apiSecret string) *YellowClient {
 	return &YellowClient{
-		client:    &http.Client{},
+		// one transport for the client, so connections are pooled across requests
+		client: &http.Client{
+			Timeout: time.Second * 10,
+			Transport: &http.Transport{
+				MaxIdleConns:        100,
+				MaxIdleConnsPerHost: 20,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse },
+		},
 		baseUrl:   baseUrl,
 		apiKey:    apiKey,
 		apiSecret: apiSecret,
@@ -98,14 +145,6 @@ func NewYellowClient(baseUrl, apiKey, apiSecret string) *YellowClient {
 
 // httpAuth method to generate authorization headers
 func (yc *YellowClient) httpAuth(path, method string, body map[string]interface{}) (map[string]string, error) {
-	yc.client.Timeout = time.Second * 10
-	yc.client.Transport = &http.Transport{
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 20,
-	}
-	yc.client.Jar = nil
-	yc.client.CheckRedirect = func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse }
-
 	date := time.Now().UTC().Format(time.RFC3339)
 	h := hmac.New(sha256.New, []byte(yc.apiSecret))
 	h.Write([]byte(date))
@@ -133,6 +172,11 @@ func (yc *YellowClient) httpAuth(path, method string, body map[string]interface{
 
 // MakeRequest method to make an authorized request
 func (yc *YellowClient) MakeRequest(method string, path string, body map[string]interface{}) (*http.Response, error) {
+	return yc.MakeRequestWithContext(context.Background(), method, path, body)
+}
+
+// MakeRequestWithContext makes an authorized request that is abandoned when ctx is done.
+func (yc *YellowClient) MakeRequestWithContext(ctx context.Context, method string, path string, body map[string]interface{}) (*http.Response, error) {
 	headers, err := yc.httpAuth(path, method, body)
 	if err != nil {
 		return nil, err
@@ -150,7 +194,7 @@ func (yc *YellowClient) MakeRequest(method string, path string, body map[string]
 		}
 	}
 	http.DefaultClient = yc.client
-	req, err := http.NewRequest(method, url, strings.NewReader(string(bodyBytes)))
+	req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(string(bodyBytes)))
 	if err != nil {
 		return nil, err
 	}
@@ -163,11 +207,20 @@ func (yc *YellowClient) MakeRequest(method string, path string, body map[string]
 	}
 
 	if !lo.Contains([]int{http.StatusCreated, http.StatusOK, http.StatusNoContent}, resp.StatusCode) {
+		// callers only look at the status of a failed response, so its body is done with here
+		defer resp.Body.Close()
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
 			return resp, err
 		}
-		return resp, fmt.Errorf("failed to submit payment = %v , code = %v", string(body), resp.Status)
+		apiErr := &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
+		var errorBody struct {
+			Code string `json:"code"`
+		}
+		if json.Unmarshal(body, &errorBody) == nil {
+			apiErr.Code = errorBody.Code
+		}
+		return resp, apiErr
 	}
 
 	return resp, nil
@@ -230,3 +283,110 @@ func (yc *YellowClient) GetYellowCardRates() ([]Rate, error) {
 	}
 	return rateResponse.Rates, nil
 }
+
+func (yc *YellowClient) GetAccounts() ([]AccountDetail, error) {
+	var accountDetailResponse AccountDetailResponse
+	resp, err := yc.MakeRequest(http.MethodGet, "/business/account", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(body, &accountDetailResponse)
+
+	if err != nil {
+		return nil, err
+	}
+	return accountDetailResponse.AccountDetail, nil
+}
+
+func (yc *YellowClient) ResolveBankAccount(accountNumber, networkId string) (ResolvedAccount, error) {
+	var resolvedAccount ResolvedAccount
+	resp, err := yc.MakeRequest(http.MethodPost, "/business/details/bank", map[string]interface{}{
+		"accountNumber": accountNumber,
+		"networkId":     networkId,
+	})
+	if err != nil {
+		return resolvedAccount, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resolvedAccount, err
+	}
+	err = json.Unmarshal(body, &resolvedAccount)
+
+	if err != nil {
+		return resolvedAccount, err
+	}
+	return resolvedAccount, nil
+}
+
+func (yc *YellowClient) SubmitPayment(paymentRequest models.PaymentRequest) (models.Payment, error) {
+	paymentDetails, err := toRequestBody(paymentRequest)
+	if err != nil {
+		return models.Payment{}, err
+	}
+	return yc.paymentRequest(context.Background(), http.MethodPost, "/business/payments", paymentDetails)
+}
+
+// AcceptPayment confirms a payment that was submitted without forceAccept.
+func (yc *YellowClient) AcceptPayment(paymentId string) (models.Payment, error) {
+	return yc.paymentRequest(context.Background(), http.MethodPost, "/business/payments/"+paymentId+"/accept", nil)
+}
+
+// DenyPayment rejects a payment that was submitted without forceAccept.
+func (yc *YellowClient) DenyPayment(paymentId string) (models.Payment, error) {
+	return yc.paymentRequest(context.Background(), http.MethodPost, "/business/payments/"+paymentId+"/deny", nil)
+}
+
+// GetPayment looks up the current state of a payment, giving up when ctx is done.
+func (yc *YellowClient) GetPayment(ctx context.Context, paymentId string) (models.Payment, error) {
+	return yc.paymentRequest(ctx, http.MethodGet, "/business/payments/"+paymentId, nil)
+}
+
+// GetPaymentBySequenceID looks up the payment submitted with the sequenceId. It
+// returns ErrPaymentNotFound when Yellow Card never received one.
+func (yc *YellowClient) GetPaymentBySequenceID(sequenceId string) (models.Payment, error) {
+	return yc.paymentRequest(context.Background(), http.MethodGet, "/business/payments/sequence-id/"+sequenceId, nil)
+}
+
+func (yc *YellowClient) paymentRequest(ctx context.Context, method, path string, body map[string]interface{}) (models.Payment, error) {
+	var payment models.Payment
+	resp, err := yc.MakeRequestWithContext(ctx, method, path, body)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil && method == http.MethodGet && resp != nil && resp.StatusCode == http.StatusNotFound {
+		return payment, fmt.Errorf("%w: %v", ErrPaymentNotFound, err)
+	}
+	if err != nil {
+		return payment, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return payment, err
+	}
+	err = json.Unmarshal(respBody, &payment)
+
+	if err != nil {
+		return payment, err
+	}
+	return payment, nil
+}
+
+// toRequestBody converts a typed request into the generic body MakeRequest signs and sends.
+func toRequestBody(v any) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
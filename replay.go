@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"yc-backend/common"
+	"yc-backend/internals"
+	"yc-backend/repository"
+	"yc-backend/services"
+	"yc-backend/utils"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// replayWebhooks runs stored webhook events through the webhook handling again
+// and prints the report as JSON:
+//
+//	yc-backend replay-webhooks [-event-id id] [-sequence-id id] [-from date] [-to date] [-dry-run] [-force]
+func replayWebhooks(config *common.Config, logger internals.Logger, args []string) error {
+	flags := flag.NewFlagSet("replay-webhooks", flag.ContinueOnError)
+	eventID := flags.String("event-id", "", "replay the event with this Yellow Card event id")
+	sequenceID := flags.String("sequence-id", "", "replay the events of the payment with this sequenceId")
+	from := flags.String("from", "", "replay events received from this date or RFC3339 time")
+	to := flags.String("to", "", "replay events received up to this date or RFC3339 time")
+	dryRun := flags.Bool("dry-run", false, "report the status changes without applying them")
+	force := flags.Bool("force", false, "rebuild the statuses from all stored events of the payments, even out of a terminal status")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	filter := services.WebhookEventFilter{EventID: *eventID, SequenceID: *sequenceID}
+	var err error
+	if filter.From, err = utils.ParseTime(*from, false); err != nil {
+		return err
+	}
+	if filter.To, err = utils.ParseTime(*to, true); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	client := setupDatabase(options.Client().ApplyURI(config.MongoDB.DBUri))
+	defer client.Disconnect(ctx)
+	repos := repository.InitRepositories(client.Database(config.MongoDB.DatabaseName))
+
+	svc := services.NewDisbursementService(config, repos, logger)
+	replay := svc.ReplayWebhooks
+	if *force {
+		replay = svc.RebuildWebhookStatuses
+	}
+	report, err := replay(ctx, filter, *dryRun)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
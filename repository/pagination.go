@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// PageQuery describes a cursor-paginated query. Results are ordered by SortField
+// and then _id, so the cursor stays stable when several documents share a value.
+type PageQuery struct {
+	Filter    bson.D
+	SortField string
+	SortDesc  bool
+	Limit     int64
+	Cursor    string
+}
+
+// Page is one page of results. NextCursor is empty on the last page.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+type pageCursor struct {
+	Value bson.RawValue      `bson:"v"`
+	ID    primitive.ObjectID `bson:"id"`
+}
+
+// FindPage returns the page of documents following query.Cursor.
+func (r *Repository[T]) FindPage(ctx context.Context, query PageQuery) (*Page[T], error) {
+	sortField := query.SortField
+	if sortField == "" {
+		sortField = "_id"
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+	order, op := 1, "$gt"
+	if query.SortDesc {
+		order, op = -1, "$lt"
+	}
+
+	filter := query.Filter
+	if filter == nil {
+		filter = bson.D{}
+	}
+	if query.Cursor != "" {
+		cursor, err := decodePageCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after := bson.D{{Key: "_id", Value: bson.D{{Key: op, Value: cursor.ID}}}}
+		if sortField != "_id" {
+			after = bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: sortField, Value: bson.D{{Key: op, Value: cursor.Value}}}},
+				bson.D{{Key: sortField, Value: cursor.Value}, {Key: "_id", Value: bson.D{{Key: op, Value: cursor.ID}}}},
+			}}}
+		}
+		filter = bson.D{{Key: "$and", Value: bson.A{filter, after}}}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: sortField, Value: order}, {Key: "_id", Value: order}}).
+		SetLimit(limit + 1)
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	page := &Page[T]{Items: []T{}}
+	var last bson.Raw
+	for cursor.Next(ctx) {
+		if int64(len(page.Items)) == limit {
+			next, err := encodePageCursor(last, sortField)
+			if err != nil {
+				return nil, err
+			}
+			page.NextCursor = next
+			break
+		}
+		var result T
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+		page.Items = append(page.Items, result)
+		last = append(bson.Raw{}, cursor.Current...)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func encodePageCursor(document bson.Raw, sortField string) (string, error) {
+	id, ok := document.Lookup("_id").ObjectIDOK()
+	if !ok {
+		return "", ErrInvalidCursor
+	}
+	value, err := document.LookupErr(sortField)
+	if err != nil {
+		value = bson.RawValue{Type: bson.TypeNull}
+	}
+	data, err := bson.Marshal(pageCursor{Value: value, ID: id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodePageCursor(encoded string) (pageCursor, error) {
+	var cursor pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := bson.Unmarshal(data, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
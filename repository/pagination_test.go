@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gookit/goutil/testutil/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+type pageItem struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	CreatedAt time.Time          `bson:"createdAt"`
+}
+
+func pageItemDoc(item pageItem) bson.D {
+	return bson.D{{Key: "_id", Value: item.ID}, {Key: "createdAt", Value: item.CreatedAt}}
+}
+
+func TestPageCursorRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+	createdAt := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	document, err := bson.Marshal(pageItem{ID: id, CreatedAt: createdAt})
+	assert.NoErr(t, err)
+
+	encoded, err := encodePageCursor(document, "createdAt")
+	assert.NoErr(t, err)
+	cursor, err := decodePageCursor(encoded)
+	assert.NoErr(t, err)
+
+	assert.Eq(t, id, cursor.ID)
+	assert.Eq(t, createdAt, cursor.Value.Time().UTC())
+}
+
+func TestMalformedPageCursorIsInvalid(t *testing.T) {
+	notBson := "bm90LWJzb24"
+	for _, encoded := range []string{"not a cursor!", notBson} {
+		_, err := decodePageCursor(encoded)
+		assert.ErrIs(t, err, ErrInvalidCursor)
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("find page", func(mt *mtest.T) {
+		repo := NewRepository[pageItem](mt.Coll)
+
+		_, err := repo.FindPage(context.Background(), PageQuery{SortField: "createdAt", Cursor: "not a cursor!"})
+
+		assert.ErrIs(t, err, ErrInvalidCursor)
+		// the cursor is rejected before anything is queried
+		assert.Len(t, mt.GetAllStartedEvents(), 0)
+	})
+}
+
+func TestFindPageBreaksTiesOnId(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("equal createdAt", func(mt *mtest.T) {
+		repo := NewRepository[pageItem](mt.Coll)
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		createdAt := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+		items := []pageItem{
+			{ID: primitive.NewObjectID(), CreatedAt: createdAt},
+			{ID: primitive.NewObjectID(), CreatedAt: createdAt},
+			{ID: primitive.NewObjectID(), CreatedAt: createdAt},
+		}
+
+		// the first page fetches one document past the limit to learn there is more
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch,
+			pageItemDoc(items[0]), pageItemDoc(items[1]), pageItemDoc(items[2])))
+		first, err := repo.FindPage(context.Background(), PageQuery{SortField: "createdAt", SortDesc: true, Limit: 2})
+		assert.NoErr(t, err)
+		assert.Len(t, first.Items, 2)
+		assert.NotEmpty(t, first.NextCursor)
+
+		command := mt.GetStartedEvent().Command
+		assert.Eq(t, int64(3), command.Lookup("limit").AsInt64())
+		sort := command.Lookup("sort").Document()
+		assert.Eq(t, "createdAt", sort.Index(0).Key())
+		assert.Eq(t, "_id", sort.Index(1).Key())
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, pageItemDoc(items[2])))
+		second, err := repo.FindPage(context.Background(), PageQuery{SortField: "createdAt", SortDesc: true, Limit: 2, Cursor: first.NextCursor})
+		assert.NoErr(t, err)
+		assert.Len(t, second.Items, 1)
+		assert.Empty(t, second.NextCursor)
+
+		// documents sharing the cursor's createdAt continue after its _id
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		after := filter.Lookup("$and").Array().Index(1).Value().Document()
+		tie := after.Lookup("$or").Array().Index(1).Value().Document()
+		assert.Eq(t, createdAt, tie.Lookup("createdAt").Time().UTC())
+		assert.Eq(t, items[1].ID, tie.Lookup("_id", "$lt").ObjectID())
+		older := after.Lookup("$or").Array().Index(0).Value().Document()
+		assert.Eq(t, createdAt, older.Lookup("createdAt", "$lt").Time().UTC())
+	})
+}
@@ -14,6 +14,16 @@ type Repositories struct {
 	User         Repository[models.User]
 	Employee     Repository[models.Employee]
 	Disbursement Repository[models.Disbursement]
+	PayrollRun   Repository[models.PayrollRun]
+	PaySchedule  Repository[models.PaySchedule]
+	PayExecution Repository[models.PayScheduleExecution]
+	Idempotency  Repository[models.IdempotencyRecord]
+	Approval     Repository[models.ApprovalPolicy]
+	SpendLimit   Repository[models.SpendingLimitPolicy]
+	Business     Repository[models.Business]
+	WorkItem     Repository[models.PayrollWorkItem]
+	WebhookEvent Repository[models.WebhookEvent]
+	SpendCounter Repository[models.SpendingCounter]
 }
 
 func InitRepositories(db *mongo.Database) *Repositories {
@@ -21,36 +31,120 @@ func InitRepositories(db *mongo.Database) *Repositories {
 	userRepo := NewRepository[models.User](db.Collection("users"))
 	employeeRepo := NewRepository[models.Employee](db.Collection("employees"))
 	disbursementRepo := NewRepository[models.Disbursement](db.Collection("disbursement"))
+	payrollRunRepo := NewRepository[models.PayrollRun](db.Collection("payroll_runs"))
+	payScheduleRepo := NewRepository[models.PaySchedule](db.Collection("pay_schedules"))
+	payExecutionRepo := NewRepository[models.PayScheduleExecution](db.Collection("pay_schedule_executions"))
+	idempotencyRepo := NewRepository[models.IdempotencyRecord](db.Collection("idempotency_keys"))
+	approvalRepo := NewRepository[models.ApprovalPolicy](db.Collection("approval_policies"))
+	spendLimitRepo := NewRepository[models.SpendingLimitPolicy](db.Collection("spending_limits"))
+	businessRepo := NewRepository[models.Business](db.Collection("businesses"))
+	workItemRepo := NewRepository[models.PayrollWorkItem](db.Collection("payroll_work_items"))
+	webhookEventRepo := NewRepository[models.WebhookEvent](db.Collection("webhook_events"))
+	spendCounterRepo := NewRepository[models.SpendingCounter](db.Collection("spending_counters"))
 	return &Repositories{
 		User:         userRepo,
 		Employee:     employeeRepo,
 		Disbursement: disbursementRepo,
+		PayrollRun:   payrollRunRepo,
+		PaySchedule:  payScheduleRepo,
+		PayExecution: payExecutionRepo,
+		Idempotency:  idempotencyRepo,
+		Approval:     approvalRepo,
+		SpendLimit:   spendLimitRepo,
+		Business:     businessRepo,
+		WorkItem:     workItemRepo,
+		WebhookEvent: webhookEventRepo,
+		SpendCounter: spendCounterRepo,
 	}
 }
 
+// EnsureIndexes creates the indexes the application relies on for uniqueness guarantees.
+func (r *Repositories) EnsureIndexes(ctx context.Context) error {
+	if _, err := r.PaySchedule.CreateIndex(ctx,
+		bson.D{{Key: "user_id", Value: 1}},
+		options.Index().SetUnique(true)); err != nil {
+		return err
+	}
+	if _, err := r.Approval.CreateIndex(ctx,
+		bson.D{{Key: "user_id", Value: 1}},
+		options.Index().SetUnique(true)); err != nil {
+		return err
+	}
+	if _, err := r.SpendLimit.CreateIndex(ctx,
+		bson.D{{Key: "user_id", Value: 1}},
+		options.Index().SetUnique(true)); err != nil {
+		return err
+	}
+	if _, err := r.Business.CreateIndex(ctx,
+		bson.D{{Key: "user_id", Value: 1}},
+		options.Index().SetUnique(true)); err != nil {
+		return err
+	}
+	if _, err := r.WorkItem.CreateIndex(ctx,
+		bson.D{{Key: "run_id", Value: 1}, {Key: "employee_id", Value: 1}},
+		options.Index().SetUnique(true)); err != nil {
+		return err
+	}
+	if _, err := r.WorkItem.CreateIndex(ctx,
+		bson.D{{Key: "sequence_id", Value: 1}},
+		options.Index().SetUnique(true)); err != nil {
+		return err
+	}
+	// deliveries without an event id cannot be deduplicated and are all kept
+	if _, err := r.WebhookEvent.CreateIndex(ctx,
+		bson.D{{Key: "event_id", Value: 1}},
+		options.Index().SetUnique(true).SetSparse(true)); err != nil {
+		return err
+	}
+	if _, err := r.SpendCounter.CreateIndex(ctx,
+		bson.D{{Key: "scope", Value: 1}, {Key: "owner_id", Value: 1}, {Key: "period", Value: 1}, {Key: "period_start", Value: 1}},
+		options.Index().SetUnique(true)); err != nil {
+		return err
+	}
+	if _, err := r.PayExecution.CreateIndex(ctx,
+		bson.D{{Key: "schedule_id", Value: 1}, {Key: "scheduled_for", Value: 1}},
+		options.Index().SetUnique(true)); err != nil {
+		return err
+	}
+	if _, err := r.Idempotency.CreateIndex(ctx,
+		bson.D{{Key: "user_id", Value: 1}, {Key: "key", Value: 1}},
+		options.Index().SetUnique(true)); err != nil {
+		return err
+	}
+	if _, err := r.Idempotency.CreateIndex(ctx,
+		bson.D{{Key: "createdAt", Value: 1}},
+		options.Index().SetExpireAfterSeconds(int32(models.IdempotencyKeyTTL.Seconds()))); err != nil {
+		return err
+	}
+	return nil
+}
+
 // IRepository defines the methods that a repository must implement.
-type IRepository[T comparable] interface {
+type IRepository[T any] interface {
 	Create(ctx context.Context, document T) (any, error)
 	FindOneById(ctx context.Context, id primitive.ObjectID) (*T, error)
 	FindOne(ctx context.Context, filter bson.D) (*T, error)
 	FindMany(ctx context.Context, filter bson.D) ([]T, error)
+	FindPage(ctx context.Context, query PageQuery) (*Page[T], error)
 	UpdateOneById(ctx context.Context, id primitive.ObjectID, document T) error
 	UpdateMany(ctx context.Context, filter bson.D, document T) error
+	FindOneAndUpdate(ctx context.Context, filter bson.D, update bson.D) (*T, error)
 	DeleteById(ctx context.Context, id primitive.ObjectID) error
 	DeleteMany(ctx context.Context, filter bson.D) error
 	Count(ctx context.Context, filter bson.D) (int64, error)
+	Sum(ctx context.Context, filter bson.D, field string) (float64, error)
 	CreateIndex(ctx context.Context, keys bson.D, opt *options.IndexOptions) (string, error)
 	EstimatedDocumentCount(ctx context.Context) (int64, error)
 	Aggregate(ctx context.Context, pipeline mongo.Pipeline, opts ...*options.AggregateOptions) ([]*T, error)
 }
 
 // Repository is a MongoDB repository implementation.
-type Repository[T comparable] struct {
+type Repository[T any] struct {
 	collection *mongo.Collection // MongoDB collection
 }
 
 // NewRepository creates a new instance of Repository.
-func NewRepository[T comparable](collection *mongo.Collection) Repository[T] {
+func NewRepository[T any](collection *mongo.Collection) Repository[T] {
 	return Repository[T]{collection: collection}
 }
 
@@ -122,6 +216,18 @@ func (r *Repository[T]) UpdateMany(ctx context.Context, filter bson.D, document
 	return err
 }
 
+// FindOneAndUpdate applies a raw update to the first document matching the filter and
+// returns the updated document. It returns mongo.ErrNoDocuments when nothing matched.
+func (r *Repository[T]) FindOneAndUpdate(ctx context.Context, filter bson.D, update bson.D) (*T, error) {
+	var result T
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 // DeleteById deletes a single document by its ID from the MongoDB collection.
 func (r *Repository[T]) DeleteById(ctx context.Context, id primitive.ObjectID) error {
 	filter := bson.D{{Key: "_id", Value: id}}
@@ -144,6 +250,31 @@ func (r *Repository[T]) Count(ctx context.Context, filter bson.D) (int64, error)
 	return count, nil
 }
 
+// Sum adds up a numeric field over the documents matching the filter.
+func (r *Repository[T]) Sum(ctx context.Context, filter bson.D, field string) (float64, error) {
+	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$" + field}}},
+		}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		Total float64 `bson:"total"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, err
+		}
+	}
+	return result.Total, cursor.Err()
+}
+
 // CreateIndex creates an index in the MongoDB collection based on the specified keys and options.
 func (r *Repository[T]) CreateIndex(ctx context.Context, keys bson.D, opt *options.IndexOptions) (string, error) {
 	index := mongo.IndexModel{
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+	"yc-backend/models"
+
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrNotAwaitingApproval = errors.New("disbursement is not awaiting approval")
+	ErrNotAnApprover       = errors.New("user is not an approver for this business")
+	ErrSelfApproval        = errors.New("the initiator of a disbursement cannot approve it")
+	ErrApprovalLoosened    = errors.New("only admins can disable or loosen the approval policy")
+)
+
+// ApprovalPolicy returns the approval policy of the business, or nil when it has none.
+func (s *DisbursementService) ApprovalPolicy(ctx context.Context, businessID primitive.ObjectID) (*models.ApprovalPolicy, error) {
+	policy, err := s.repos.Approval.FindOne(ctx, bson.D{{Key: "user_id", Value: businessID}})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	return policy, err
+}
+
+// SaveApprovalPolicy stores the approval policy of the business. The owner
+// initiates the disbursements the policy checks, so unless asAdmin is set an
+// enabled policy may only be made stricter: it cannot be disabled, have its
+// threshold raised, stop covering payroll runs or have its approvers changed.
+func (s *DisbursementService) SaveApprovalPolicy(ctx context.Context, policy models.ApprovalPolicy, asAdmin bool) (*models.ApprovalPolicy, error) {
+	current, err := s.ApprovalPolicy(ctx, policy.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !asAdmin && !approvalWithin(policy, current) {
+		return nil, ErrApprovalLoosened
+	}
+
+	timeNow := time.Now()
+	policy.UpdatedAt = &timeNow
+	if current == nil {
+		policy.CreatedAt = &timeNow
+		id, err := s.repos.Approval.Create(ctx, policy)
+		if err != nil {
+			return nil, err
+		}
+		if policyId, ok := id.(primitive.ObjectID); ok {
+			policy.ID = policyId
+		}
+		return &policy, nil
+	}
+
+	policy.ID = current.ID
+	if err := s.repos.Approval.UpdateOneById(ctx, current.ID, policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// approvalWithin reports whether next checks at least every disbursement the
+// current policy checks, with the same approvers.
+func approvalWithin(next models.ApprovalPolicy, current *models.ApprovalPolicy) bool {
+	if current == nil || !current.Enabled {
+		return true
+	}
+	if !next.Enabled || next.Threshold > current.Threshold {
+		return false
+	}
+	if current.RequireForPayrollRuns && !next.RequireForPayrollRuns {
+		return false
+	}
+	added, removed := lo.Difference(next.Approvers, current.Approvers)
+	return len(added) == 0 && len(removed) == 0
+}
+
+func (s *DisbursementService) requiresApproval(ctx context.Context, disbursement *models.Disbursement) (bool, error) {
+	policy, err := s.ApprovalPolicy(ctx, disbursement.SenderID)
+	if err != nil || policy == nil {
+		return false, err
+	}
+	return needsApproval(policy, disbursement), nil
+}
+
+// needsApproval applies the policy to the disbursement. The threshold is in USD,
+// so a disbursement whose amount could not be converted needs approval.
+func needsApproval(policy *models.ApprovalPolicy, disbursement *models.Disbursement) bool {
+	if !policy.Enabled {
+		return false
+	}
+	if policy.RequireForPayrollRuns && !disbursement.PayrollRunID.IsZero() {
+		return true
+	}
+	return disbursement.AmountUSD <= 0 || disbursement.AmountUSD > policy.Threshold
+}
+
+// Approve records the approver's decision and then submits the disbursement.
+// The decision is persisted, and the disbursement claimed, before Yellow Card
+// is called, so concurrent approvals cannot submit the payment twice. A
+// disbursement the balance cannot cover stays awaiting approval.
+func (s *DisbursementService) Approve(ctx context.Context, approver *models.User, disbursementID primitive.ObjectID, comment string) (*models.Disbursement, error) {
+	disbursement, err := s.awaitingDecision(ctx, approver, disbursementID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.Preflight(ctx, []models.PaymentRequest{*disbursement.PaymentRequest}); err != nil {
+		return nil, err
+	}
+	return s.approve(ctx, approver, disbursement, comment)
+}
+
+func (s *DisbursementService) approve(ctx context.Context, approver *models.User, disbursement *models.Disbursement, comment string) (*models.Disbursement, error) {
+	disbursement, err := s.decide(ctx, approver, disbursement, models.ApprovalApproved, comment)
+	if err != nil {
+		return nil, err
+	}
+	return s.submit(ctx, disbursement)
+}
+
+// Reject records the approver's decision; the disbursement is never submitted.
+func (s *DisbursementService) Reject(ctx context.Context, approver *models.User, disbursementID primitive.ObjectID, comment string) (*models.Disbursement, error) {
+	disbursement, err := s.awaitingDecision(ctx, approver, disbursementID)
+	if err != nil {
+		return nil, err
+	}
+	return s.decide(ctx, approver, disbursement, models.ApprovalRejected, comment)
+}
+
+// awaitingDecision loads a disbursement the approver may decide on.
+func (s *DisbursementService) awaitingDecision(ctx context.Context, approver *models.User, disbursementID primitive.ObjectID) (*models.Disbursement, error) {
+	disbursement, err := s.repos.Disbursement.FindOneById(ctx, disbursementID)
+	if err != nil {
+		return nil, err
+	}
+	if disbursement.Status != models.DisbursementAwaitingApproval {
+		return nil, ErrNotAwaitingApproval
+	}
+
+	policy, err := s.ApprovalPolicy(ctx, disbursement.SenderID)
+	if err != nil {
+		return nil, err
+	}
+	if !canApprove(policy, disbursement.SenderID, approver.ID) {
+		return nil, ErrNotAnApprover
+	}
+	if approver.ID == disbursement.InitiatedBy {
+		return nil, ErrSelfApproval
+	}
+	return disbursement, nil
+}
+
+func (s *DisbursementService) decide(ctx context.Context, approver *models.User, disbursement *models.Disbursement, decision, comment string) (*models.Disbursement, error) {
+	next := models.DisbursementCreated
+	if decision == models.ApprovalRejected {
+		next = models.DisbursementRejected
+	}
+
+	timeNow := time.Now()
+	updated, err := s.repos.Disbursement.FindOneAndUpdate(ctx,
+		bson.D{
+			{Key: "_id", Value: disbursement.ID},
+			{Key: "status", Value: models.DisbursementAwaitingApproval},
+		},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "status", Value: next},
+				{Key: "updatedAt", Value: timeNow},
+			}},
+			{Key: "$push", Value: bson.D{
+				{Key: "approvals", Value: models.ApprovalDecision{
+					ApproverID: approver.ID,
+					Decision:   decision,
+					Comment:    comment,
+					DecidedAt:  timeNow,
+				}},
+				{Key: "status_history", Value: models.StatusChange{
+					Status:    next,
+					Source:    models.StatusSourceAPI,
+					Timestamp: timeNow,
+				}},
+			}},
+		})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotAwaitingApproval
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if next == models.DisbursementRejected {
+		s.releaseLimits(ctx, updated)
+	}
+	s.logger.Infof("disbursement [%s] %s by [%s]", updated.ID.Hex(), decision, approver.ID.Hex())
+	return updated, nil
+}
+
+// canApprove reports whether the user may act on approvals for the business.
+// The business owner may always approve requests initiated by someone else.
+func canApprove(policy *models.ApprovalPolicy, businessID, userID primitive.ObjectID) bool {
+	if userID == businessID {
+		return true
+	}
+	return policy != nil && lo.Contains(policy.Approvers, userID)
+}
+
+// PendingApprovals lists the disbursements the user can approve.
+func (s *DisbursementService) PendingApprovals(ctx context.Context, approver *models.User) ([]models.Disbursement, error) {
+	policies, err := s.repos.Approval.FindMany(ctx, bson.D{{Key: "approvers", Value: approver.ID}})
+	if err != nil {
+		return nil, err
+	}
+	businessIds := append([]primitive.ObjectID{approver.ID}, lo.Map(policies, func(policy models.ApprovalPolicy, _ int) primitive.ObjectID {
+		return policy.UserID
+	})...)
+
+	disbursements, err := s.repos.Disbursement.FindMany(ctx, bson.D{
+		{Key: "sender_id", Value: bson.D{{Key: "$in", Value: businessIds}}},
+		{Key: "status", Value: models.DisbursementAwaitingApproval},
+		{Key: "initiated_by", Value: bson.D{{Key: "$ne", Value: approver.ID}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if disbursements == nil {
+		disbursements = []models.Disbursement{}
+	}
+	return disbursements, nil
+}
+
+// DecidePayrollRun applies the approver's decision to every disbursement of the
+// run that is still awaiting approval.
+func (s *DisbursementService) DecidePayrollRun(ctx context.Context, approver *models.User, runID primitive.ObjectID, approve bool, comment string) ([]models.Disbursement, []models.PayrollRunFailure, error) {
+	run, err := s.repos.PayrollRun.FindOneById(ctx, runID)
+	if err != nil {
+		return nil, nil, err
+	}
+	policy, err := s.ApprovalPolicy(ctx, run.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !canApprove(policy, run.UserID, approver.ID) {
+		return nil, nil, ErrNotAnApprover
+	}
+
+	awaiting, err := s.repos.Disbursement.FindMany(ctx, bson.D{
+		{Key: "payroll_run_id", Value: runID},
+		{Key: "status", Value: models.DisbursementAwaitingApproval},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if approve {
+		payments := lo.FilterMap(awaiting, func(disbursement models.Disbursement, _ int) (models.PaymentRequest, bool) {
+			if disbursement.PaymentRequest == nil {
+				return models.PaymentRequest{}, false
+			}
+			return *disbursement.PaymentRequest, true
+		})
+		if _, err := s.Preflight(ctx, payments); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	decided := []models.Disbursement{}
+	failures := []models.PayrollRunFailure{}
+	for _, disbursement := range awaiting {
+		var result *models.Disbursement
+		if approve {
+			result, err = s.awaitingDecision(ctx, approver, disbursement.ID)
+			if err == nil {
+				result, err = s.approve(ctx, approver, result, comment)
+			}
+		} else {
+			result, err = s.Reject(ctx, approver, disbursement.ID, comment)
+		}
+		if err != nil {
+			failures = append(failures, models.PayrollRunFailure{EmployeeID: disbursement.ReceiverID, Error: err.Error()})
+			continue
+		}
+		decided = append(decided, *result)
+	}
+	return decided, failures, nil
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"testing"
+	"yc-backend/models"
+
+	"github.com/gookit/goutil/testutil/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNeedsApprovalComparesThresholdInUSD(t *testing.T) {
+	policy := &models.ApprovalPolicy{Enabled: true, Threshold: 1000}
+
+	// 1,200,000 NGN is 800 USD at 1500
+	assert.False(t, needsApproval(policy, &models.Disbursement{SalaryAmount: 1200000, Currency: "NGN", AmountUSD: 800}))
+	assert.True(t, needsApproval(policy, &models.Disbursement{SalaryAmount: 1200, Currency: USD, AmountUSD: 1200}))
+	// without a rate the amount cannot be compared
+	assert.True(t, needsApproval(policy, &models.Disbursement{SalaryAmount: 10, Currency: "XOF"}))
+}
+
+func TestNeedsApprovalForPayrollRuns(t *testing.T) {
+	policy := &models.ApprovalPolicy{Enabled: true, Threshold: 1000, RequireForPayrollRuns: true}
+
+	assert.True(t, needsApproval(policy, &models.Disbursement{AmountUSD: 10, PayrollRunID: primitive.NewObjectID()}))
+	assert.False(t, needsApproval(&models.ApprovalPolicy{}, &models.Disbursement{AmountUSD: 5000}))
+}
+
+func TestApprovalWithinAllowsTighteningOnly(t *testing.T) {
+	approver, other := primitive.NewObjectID(), primitive.NewObjectID()
+	current := &models.ApprovalPolicy{Enabled: true, Threshold: 1000, RequireForPayrollRuns: true, Approvers: []primitive.ObjectID{approver}}
+
+	tests := []struct {
+		name string
+		next models.ApprovalPolicy
+		want bool
+	}{
+		{"unchanged", *current, true},
+		{"lower threshold", models.ApprovalPolicy{Enabled: true, Threshold: 500, RequireForPayrollRuns: true, Approvers: []primitive.ObjectID{approver}}, true},
+		{"disabled", models.ApprovalPolicy{Enabled: false, Threshold: 1000, RequireForPayrollRuns: true, Approvers: []primitive.ObjectID{approver}}, false},
+		{"higher threshold", models.ApprovalPolicy{Enabled: true, Threshold: 5000, RequireForPayrollRuns: true, Approvers: []primitive.ObjectID{approver}}, false},
+		{"payroll runs exempt", models.ApprovalPolicy{Enabled: true, Threshold: 1000, Approvers: []primitive.ObjectID{approver}}, false},
+		{"approver replaced", models.ApprovalPolicy{Enabled: true, Threshold: 1000, RequireForPayrollRuns: true, Approvers: []primitive.ObjectID{other}}, false},
+		{"approver removed", models.ApprovalPolicy{Enabled: true, Threshold: 1000, RequireForPayrollRuns: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Eq(t, tt.want, approvalWithin(tt.next, current))
+		})
+	}
+
+	// a business without an enabled policy can set up any policy
+	assert.True(t, approvalWithin(models.ApprovalPolicy{Enabled: true, Approvers: []primitive.ObjectID{other}}, nil))
+	assert.True(t, approvalWithin(models.ApprovalPolicy{}, &models.ApprovalPolicy{}))
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"yc-backend/models"
+	"yc-backend/pkg"
+
+	"github.com/samber/lo"
+)
+
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+// BalanceReport compares what a set of payments in one currency needs with
+// the balance available to fund them. Amounts are in the payment currency.
+type BalanceReport struct {
+	Currency      string  `json:"currency"`
+	Payments      int     `json:"payments"`
+	Amount        float64 `json:"amount"`
+	EstimatedFees float64 `json:"estimatedFees"`
+	Required      float64 `json:"required"`
+	Available     float64 `json:"available"`
+	Shortfall     float64 `json:"shortfall"`
+	// AccountCurrency and Rate are set when the payments are funded from a
+	// balance in another currency, converted at Rate.
+	AccountCurrency string  `json:"accountCurrency,omitempty"`
+	Rate            float64 `json:"rate,omitempty"`
+}
+
+// InsufficientBalanceError carries the balance reports of a preflight that
+// found a shortfall in at least one currency.
+type InsufficientBalanceError struct {
+	Reports []BalanceReport
+}
+
+func (e *InsufficientBalanceError) Error() string {
+	shortfalls := lo.FilterMap(e.Reports, func(report BalanceReport, _ int) (string, bool) {
+		return fmt.Sprintf("%.2f %s short", report.Shortfall, report.Currency), report.Shortfall > 0
+	})
+	return fmt.Sprintf("%s: %s", ErrInsufficientBalance, strings.Join(shortfalls, ", "))
+}
+
+func (e *InsufficientBalanceError) Is(target error) bool {
+	return target == ErrInsufficientBalance
+}
+
+// Preflight checks that the Yellow Card balance covers the payments plus the
+// fees of their channels, and returns an *InsufficientBalanceError with the
+// shortfall when it does not.
+func (s *DisbursementService) Preflight(ctx context.Context, payments []models.PaymentRequest) ([]BalanceReport, error) {
+	if len(payments) == 0 {
+		return []BalanceReport{}, nil
+	}
+
+	channels, err := s.client.GetYellowCardChannels()
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := s.client.GetAccounts()
+	if err != nil {
+		return nil, err
+	}
+	var rates []pkg.Rate
+
+	reports := map[string]*BalanceReport{}
+	currencies := []string{}
+	for _, payment := range payments {
+		channel, ok := lo.Find(channels, func(channel pkg.Channel) bool {
+			return channel.ID == payment.ChannelID
+		})
+		if !ok {
+			return nil, fmt.Errorf("unknown payment channel [%s]", payment.ChannelID)
+		}
+
+		report, ok := reports[channel.Currency]
+		if !ok {
+			report = &BalanceReport{Currency: channel.Currency}
+			reports[channel.Currency] = report
+			currencies = append(currencies, channel.Currency)
+		}
+		// a payment above the channel maximum is split, and each part pays the fee
+		parts := paymentParts(payment.LocalAmount, channel)
+		report.Payments += parts
+		report.Amount += payment.LocalAmount
+		report.EstimatedFees += float64(channel.FeeLocal * parts)
+	}
+
+	shortfall := false
+	result := make([]BalanceReport, 0, len(currencies))
+	for _, currency := range currencies {
+		report := reports[currency]
+		report.Amount = round2(report.Amount)
+		report.Required = round2(report.Amount + report.EstimatedFees)
+
+		if account, ok := findAccount(accounts, currency); ok {
+			report.Available = account.Available
+		} else if account, ok := findAccount(accounts, "USD"); ok {
+			// the balance is held in USD and converted on payout
+			if rates == nil {
+				if rates, err = s.client.GetYellowCardRates(); err != nil {
+					return nil, err
+				}
+			}
+			if rate, ok := lo.Find(rates, func(rate pkg.Rate) bool {
+				return strings.EqualFold(rate.Code, currency)
+			}); ok {
+				report.AccountCurrency = account.Currency
+				report.Rate = rate.Buy
+				report.Available = round2(account.Available * rate.Buy)
+			}
+		}
+
+		if report.Required > report.Available {
+			report.Shortfall = round2(report.Required - report.Available)
+			shortfall = true
+		}
+		result = append(result, *report)
+	}
+
+	if shortfall {
+		s.logger.Infof("balance preflight found a shortfall: %+v", result)
+		return result, &InsufficientBalanceError{Reports: result}
+	}
+	return result, nil
+}
+
+func findAccount(accounts []pkg.AccountDetail, currency string) (pkg.AccountDetail, bool) {
+	return lo.Find(accounts, func(account pkg.AccountDetail) bool {
+		return strings.EqualFold(account.Currency, currency)
+	})
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yc-backend/internals"
+	"yc-backend/models"
+	"yc-backend/pkg"
+
+	"github.com/gookit/goutil/testutil/assert"
+)
+
+func newPreflightService(t *testing.T, accounts string) *DisbursementService {
+	responses := map[string]string{
+		"/business/channels": `{"channels": [{"id": "ngn-bank", "currency": "NGN", "feeLocal": 100}]}`,
+		"/business/account":  accounts,
+		"/business/rates":    `{"rates": [{"code": "NGN", "buy": 1500}]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(responses[r.URL.Path]))
+	}))
+	t.Cleanup(server.Close)
+
+	return &DisbursementService{
+		client: pkg.NewYellowClient(server.URL, "key", "secret"),
+		logger: internals.GetLogger(),
+	}
+}
+
+func TestPreflightCoversPaymentsAndFees(t *testing.T) {
+	svc := newPreflightService(t, `{"accounts": [{"currency": "NGN", "available": 300200}]}`)
+
+	reports, err := svc.Preflight(context.Background(), []models.PaymentRequest{
+		{ChannelID: "ngn-bank", LocalAmount: 100000},
+		{ChannelID: "ngn-bank", LocalAmount: 200000},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, reports, 1)
+	assert.Equal(t, 200.0, reports[0].EstimatedFees)
+	assert.Equal(t, 300200.0, reports[0].Required)
+	assert.Equal(t, 0.0, reports[0].Shortfall)
+}
+
+func TestPreflightReportsShortfallOfUSDBalance(t *testing.T) {
+	svc := newPreflightService(t, `{"accounts": [{"currency": "USD", "available": 100}]}`)
+
+	reports, err := svc.Preflight(context.Background(), []models.PaymentRequest{
+		{ChannelID: "ngn-bank", LocalAmount: 200000},
+	})
+
+	assert.True(t, errors.Is(err, ErrInsufficientBalance))
+	assert.Equal(t, "USD", reports[0].AccountCurrency)
+	assert.Equal(t, 150000.0, reports[0].Available)
+	assert.Equal(t, 50100.0, reports[0].Shortfall)
+}
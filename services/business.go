@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"yc-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrBusinessProfileIncomplete = errors.New("business profile is incomplete")
+
+// SenderBusiness returns the business profile of the user, which payments are
+// sent from. Without a complete profile nothing can be paid.
+func (s *DisbursementService) SenderBusiness(ctx context.Context, userID primitive.ObjectID) (*models.Business, error) {
+	business, err := s.repos.Business.FindOne(ctx, bson.D{{Key: "user_id", Value: userID}})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: no business profile has been set up", ErrBusinessProfileIncomplete)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if business.RegistrationNumber == "" {
+		// single business deployments configure it instead
+		business.RegistrationNumber = s.cfg.AppCredentials.BusinessID
+	}
+	if missing := business.MissingFields(); len(missing) > 0 {
+		return nil, fmt.Errorf("%w: missing %s", ErrBusinessProfileIncomplete, strings.Join(missing, ", "))
+	}
+	return business, nil
+}
+
+// businessSender is the Yellow Card sender of a payment from the business.
+// Payments are sent as an institution, so the sender is the business itself;
+// the ID documents are those of the user paying on its behalf.
+func businessSender(user *models.User, business *models.Business) models.Sender {
+	address := business.Address
+	if business.City != "" {
+		address += ", " + business.City
+	}
+	return models.Sender{
+		Name:               business.RegisteredName,
+		Phone:              business.Phone,
+		Country:            business.Country,
+		Address:            address,
+		DOB:                business.IncorporatedOn,
+		Email:              business.Email,
+		IDNumber:           user.IdNumber,
+		IDType:             user.IdType,
+		BusinessID:         business.RegistrationNumber,
+		BusinessName:       business.RegisteredName,
+		AdditionalIDType:   user.AdditionalIdType,
+		AdditionalIDNumber: user.AdditionalIdNumber,
+	}
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"yc-backend/models"
+	"yc-backend/pkg"
+
+	"github.com/samber/lo"
+)
+
+const USD = "USD"
+
+var ErrNoRate = errors.New("no exchange rate")
+
+// rate returns the Yellow Card rate of the currency against USD. The rates
+// are fetched once and shared by every payment resolved from the routes.
+func (r *paymentRoutes) rate(currency string) (pkg.Rate, error) {
+	r.ratesOnce.Do(func() {
+		if r.client == nil {
+			r.ratesErr = fmt.Errorf("%w: rates are not available", ErrNoRate)
+			return
+		}
+		r.rates, r.ratesErr = r.client.GetYellowCardRates()
+	})
+	if r.ratesErr != nil {
+		return pkg.Rate{}, r.ratesErr
+	}
+
+	rate, ok := lo.Find(r.rates, func(rate pkg.Rate) bool {
+		return strings.EqualFold(rate.Code, currency) && rate.Buy > 0
+	})
+	if !ok {
+		return pkg.Rate{}, fmt.Errorf("%w from %s to %s", ErrNoRate, USD, currency)
+	}
+	return rate, nil
+}
+
+// usdAmount converts the amount to USD at the Yellow Card rate of the currency,
+// or returns zero when there is no rate for it.
+func (r *paymentRoutes) usdAmount(amount float64, currency string) float64 {
+	if strings.EqualFold(currency, USD) {
+		return amount
+	}
+	rate, err := r.rate(currency)
+	if err != nil {
+		return 0
+	}
+	return round2(amount / rate.Buy)
+}
+
+// pay works out the employee's pay in the payout currency, converting a USD
+// salary at the current Yellow Card rate.
+func (r *paymentRoutes) pay(employee *models.Employee, currency string) (models.PayBreakdown, *models.AppliedRate, error) {
+	if !paidInUSD(employee, currency) {
+		return ComputePay(employee), nil, nil
+	}
+
+	rate, err := r.rate(currency)
+	if err != nil {
+		return models.PayBreakdown{}, nil, err
+	}
+	return ComputePay(convertPay(employee, rate.Buy)), &models.AppliedRate{
+		From:      USD,
+		To:        currency,
+		Rate:      rate.Buy,
+		RateID:    rate.RateID,
+		AppliedAt: time.Now(),
+	}, nil
+}
+
+// PayInPayoutCurrency returns the employee's pay breakdown in the currency they
+// are paid out in. Only employees paid a USD salary need Yellow Card for it.
+func (s *DisbursementService) PayInPayoutCurrency(ctx context.Context, employee *models.Employee) (models.PayBreakdown, error) {
+	if !strings.EqualFold(employee.SalaryCurrency, USD) {
+		return ComputePay(employee), nil
+	}
+
+	routes, err := s.loadRoutes()
+	if err != nil {
+		return models.PayBreakdown{}, err
+	}
+	route, err := routes.resolve(employee)
+	if err != nil {
+		return models.PayBreakdown{}, err
+	}
+	breakdown, _, err := routes.pay(employee, route.Channel.Currency)
+	return breakdown, err
+}
+
+// paidInUSD reports whether the employee's salary is denominated in USD but
+// paid out in another currency.
+func paidInUSD(employee *models.Employee, currency string) bool {
+	return strings.EqualFold(employee.SalaryCurrency, USD) && !strings.EqualFold(currency, USD)
+}
+
+// convertPay returns a copy of the employee with the salary and every pay
+// component amount multiplied by rate. Percentages are left as they are.
+func convertPay(employee *models.Employee, rate float64) *models.Employee {
+	converted := *employee
+	converted.Salary = round2(employee.Salary * rate)
+	if employee.PayComponents == nil {
+		return &converted
+	}
+
+	convertItems := func(items []models.PayItem) []models.PayItem {
+		return lo.Map(items, func(item models.PayItem, _ int) models.PayItem {
+			return models.PayItem{Name: item.Name, Amount: round2(item.Amount * rate)}
+		})
+	}
+
+	components := *employee.PayComponents
+	components.Basic = round2(components.Basic * rate)
+	components.Housing = round2(components.Housing * rate)
+	components.Transport = round2(components.Transport * rate)
+	components.OtherAllowances = convertItems(components.OtherAllowances)
+	components.Deductions = convertItems(components.Deductions)
+	converted.PayComponents = &components
+	return &converted
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+	"yc-backend/models"
+	"yc-backend/pkg"
+
+	"github.com/gookit/goutil/testutil/assert"
+)
+
+func TestPayConvertsUSDSalaryAtRate(t *testing.T) {
+	routes := &paymentRoutes{}
+	routes.ratesOnce.Do(func() {
+		routes.rates = []pkg.Rate{{Code: "KES", Buy: 130, RateID: "kes-rate"}}
+	})
+
+	breakdown, rate, err := routes.pay(&models.Employee{
+		Country:        "KE",
+		SalaryCurrency: USD,
+		PayComponents: &models.PayComponents{
+			Basic:      1000,
+			Housing:    500,
+			Deductions: []models.PayItem{{Name: "loan", Amount: 100}},
+		},
+	}, "KES")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "kes-rate", rate.RateID)
+	assert.Equal(t, 130.0, rate.Rate)
+	// no Nigerian pension or PAYE outside Nigeria
+	assert.Equal(t, 195000.0, breakdown.Gross)
+	assert.Equal(t, 13000.0, breakdown.TotalDeductions)
+	assert.Equal(t, 182000.0, breakdown.Net)
+}
+
+func TestPayInLocalCurrencySkipsRates(t *testing.T) {
+	breakdown, rate, err := (&paymentRoutes{}).pay(&models.Employee{Country: "GH", Salary: 5000}, "GHS")
+
+	assert.NoError(t, err)
+	assert.Nil(t, rate)
+	assert.Equal(t, 5000.0, breakdown.Net)
+}
+
+func TestPayWithoutRateFails(t *testing.T) {
+	routes := &paymentRoutes{}
+	routes.ratesOnce.Do(func() {})
+
+	_, _, err := routes.pay(&models.Employee{SalaryCurrency: USD, Salary: 100}, "GHS")
+
+	assert.ErrIs(t, err, ErrNoRate)
+}
@@ -0,0 +1,467 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"yc-backend/common"
+	"yc-backend/internals"
+	"yc-backend/models"
+	"yc-backend/pkg"
+	"yc-backend/repository"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DisbursementService submits employee payments to Yellow Card and keeps
+// the matching models.Disbursement records up to date.
+type DisbursementService struct {
+	cfg    *common.Config
+	repos  *repository.Repositories
+	client *pkg.YellowClient
+	logger internals.Logger
+}
+
+// NewDisbursementService constructor
+func NewDisbursementService(cfg *common.Config, repos *repository.Repositories, logger internals.Logger) *DisbursementService {
+	return &DisbursementService{
+		cfg:   cfg,
+		repos: repos,
+		client: pkg.NewYellowClient(
+			cfg.YellowCardCredentials.BaseUrl,
+			cfg.YellowCardCredentials.ApiKey,
+			cfg.YellowCardCredentials.SecretKey),
+		logger: logger,
+	}
+}
+
+var (
+	ErrNothingToPay = errors.New("employee has no net pay to disburse")
+	// ErrSubmissionUnconfirmed is returned when a submission failed in a way
+	// that does not say whether Yellow Card received the payment, and looking
+	// the payment up did not settle it either. The disbursement is left created
+	// for the reconciler to resume.
+	ErrSubmissionUnconfirmed = errors.New("could not confirm whether Yellow Card received the payment")
+)
+
+type DisbursementRequest struct {
+	User         *models.User
+	Employee     *models.Employee
+	PayrollRunID primitive.ObjectID
+	// PaymentType defaults to a salary payment of the employee's net pay.
+	// Other payment types pay Amount as it is, with Reason sent to Yellow
+	// Card and Note kept on the disbursement.
+	PaymentType string
+	Amount      float64
+	Reason      string
+	Note        string
+	// Quote submits the payment without forceAccept so the rate and fees can be
+	// reviewed before the payment is accepted or denied.
+	Quote bool
+	// RetryOf is the failed disbursement this one is a new attempt of.
+	RetryOf *models.Disbursement
+	// ID is used for the new disbursement when set.
+	ID primitive.ObjectID
+	// InitiatedBy is the user who asked for the disbursement; it defaults to User.
+	InitiatedBy primitive.ObjectID
+	// OverrideLimits lets the disbursement exceed the spending limits; only
+	// admins may set it.
+	OverrideLimits bool
+	// preflighted is set when the balance was already checked for the whole
+	// payroll run the disbursement belongs to.
+	preflighted bool
+	// routes are the channels and networks to resolve the employee's payment
+	// route from; they are fetched from Yellow Card when nil.
+	routes *paymentRoutes
+	// business is the sender of the payment; it is loaded when nil.
+	business *models.Business
+	// sequenceID is the sequenceId reserved for the payment; a new one is
+	// generated when empty.
+	sequenceID string
+}
+
+// Disburse records a disbursement of the employee's net salary, together with
+// its gross-to-net breakdown, and submits it to Yellow Card unless the
+// business's approval policy requires a second user to approve it first.
+// Payments the balance cannot cover are refused with an *InsufficientBalanceError.
+// Disbursements over the spending limits are refused with a *LimitExceededError.
+func (s *DisbursementService) Disburse(ctx context.Context, req DisbursementRequest) (*models.Disbursement, error) {
+	if req.business == nil {
+		business, err := s.SenderBusiness(ctx, req.User.ID)
+		if err != nil {
+			return nil, err
+		}
+		req.business = business
+	}
+	if req.routes == nil {
+		routes, err := s.loadRoutes()
+		if err != nil {
+			return nil, err
+		}
+		req.routes = routes
+	}
+
+	disbursement, err := s.prepare(req)
+	if err != nil {
+		return nil, err
+	}
+	s.rememberNetwork(ctx, req.Employee, disbursement.PaymentRequest.Destination.NetworkID)
+
+	requiresApproval, err := s.requiresApproval(ctx, disbursement)
+	if err != nil {
+		return nil, err
+	}
+	if requiresApproval {
+		disbursement.Status = models.DisbursementAwaitingApproval
+	} else if !req.preflighted {
+		if _, err := s.Preflight(ctx, []models.PaymentRequest{*disbursement.PaymentRequest}); err != nil {
+			return nil, err
+		}
+	}
+	disbursement.StatusHistory = []models.StatusChange{{
+		Status:    disbursement.Status,
+		Source:    models.StatusSourceAPI,
+		Timestamp: *disbursement.CreatedAt,
+	}}
+
+	if err := s.create(ctx, disbursement, req.OverrideLimits); err != nil {
+		return nil, err
+	}
+
+	if requiresApproval {
+		s.logger.Infof("disbursement [%s] is awaiting approval", disbursement.ID.Hex())
+		return disbursement, nil
+	}
+	return s.submit(ctx, disbursement)
+}
+
+// create persists the disbursement once its amount is reserved on the spending
+// limits. A process stopping in between leaves the amount counted, erring on
+// the side of the limit.
+func (s *DisbursementService) create(ctx context.Context, disbursement *models.Disbursement, overrideLimits bool) error {
+	if overrideLimits {
+		disbursement.LimitsOverriddenBy = disbursement.InitiatedBy
+	}
+	if err := s.reserveLimits(ctx, disbursement, overrideLimits); err != nil {
+		return err
+	}
+
+	id, err := s.repos.Disbursement.Create(ctx, *disbursement)
+	if err != nil {
+		s.releaseLimits(ctx, disbursement)
+		return err
+	}
+	if disbursementId, ok := id.(primitive.ObjectID); ok {
+		disbursement.ID = disbursementId
+	}
+	common.RecordIdempotentWrite(ctx)
+	return nil
+}
+
+// rememberNetwork stores the network resolved for an employee that had none.
+func (s *DisbursementService) rememberNetwork(ctx context.Context, employee *models.Employee, networkID string) {
+	if employee.NetworkID != "" || employee.ID.IsZero() {
+		return
+	}
+	if err := s.repos.Employee.UpdateOneById(ctx, employee.ID, models.Employee{NetworkID: networkID}); err != nil {
+		s.logger.Errorf("could not store network of employee [%s]: %v", employee.ID.Hex(), err)
+		return
+	}
+	employee.NetworkID = networkID
+}
+
+// prepare works out what the employee is owed and builds the payment request
+// from the business over the employee's resolved route, without persisting
+// anything or calling Yellow Card. req.routes and req.business must be set.
+func (s *DisbursementService) prepare(req DisbursementRequest) (*models.Disbursement, error) {
+	user, employee, business := req.User, req.Employee, req.business
+
+	route, err := req.routes.resolve(employee)
+	if err != nil {
+		return nil, err
+	}
+	if err := accountVerified(employee); err != nil {
+		return nil, err
+	}
+	method := PayoutMethod(employee)
+	accountNumber := employee.AccountNumber
+	if accountNumber == "" && method == models.PayoutMomo {
+		accountNumber = employee.Phone
+	}
+	if accountNumber, err = NormalizeAccountNumber(method, employee.Country, accountNumber); err != nil {
+		return nil, err
+	}
+	accountName := employee.FirstName + " " + employee.LastName
+	if employee.AccountVerification != nil && employee.AccountVerification.ResolvedName != "" {
+		accountName = employee.AccountVerification.ResolvedName
+	}
+	currency := route.Channel.Currency
+
+	var (
+		breakdown   models.PayBreakdown
+		appliedRate *models.AppliedRate
+		attempt     = 1
+	)
+	if req.RetryOf != nil {
+		// a retry pays exactly what the failed attempt was meant to pay
+		attempt = max(req.RetryOf.Attempt, 1) + 1
+		breakdown = models.PayBreakdown{Gross: req.RetryOf.SalaryAmount, Net: req.RetryOf.SalaryAmount}
+		if req.RetryOf.Breakdown != nil {
+			breakdown = *req.RetryOf.Breakdown
+		}
+		appliedRate = req.RetryOf.AppliedRate
+		req.PaymentType, req.Note = req.RetryOf.PaymentType, req.RetryOf.Note
+		if req.RetryOf.PaymentRequest != nil {
+			req.Reason = req.RetryOf.PaymentRequest.Reason
+		}
+		if req.RetryOf.Currency != "" && !strings.EqualFold(req.RetryOf.Currency, currency) {
+			return nil, fmt.Errorf("%w: the employee is no longer paid in %s", ErrNoChannel, req.RetryOf.Currency)
+		}
+	} else if req.PaymentType != "" && req.PaymentType != models.PaymentTypeSalary {
+		breakdown = models.PayBreakdown{
+			Earnings: []models.PayItem{{Name: req.PaymentType, Amount: req.Amount}},
+			Gross:    req.Amount,
+			Net:      req.Amount,
+		}
+	} else {
+		breakdown, appliedRate, err = req.routes.pay(employee, currency)
+		if err != nil {
+			return nil, err
+		}
+	}
+	paymentType := req.PaymentType
+	if paymentType == "" {
+		paymentType = models.PaymentTypeSalary
+	}
+	reason := req.Reason
+	if reason == "" {
+		reason = models.DefaultPaymentReason
+	}
+	amount := breakdown.Net
+	if amount <= 0 {
+		return nil, ErrNothingToPay
+	}
+	split, err := splitAmount(amount, route.Channel)
+	if err != nil {
+		return nil, err
+	}
+	if len(split) > 1 && req.Quote {
+		return nil, ErrSplitQuote
+	}
+
+	sequenceID := req.sequenceID
+	if sequenceID == "" {
+		sequenceID = uuid.New().String()
+	}
+	paymentRequest := models.PaymentRequest{
+		ChannelID:   route.Channel.ID,
+		SequenceID:  sequenceID,
+		LocalAmount: amount,
+		Reason:      reason,
+		Sender:      businessSender(user, business),
+		Destination: models.Destination{
+			AccountNumber: accountNumber,
+			AccountType:   route.Channel.ChannelType,
+			NetworkID:     route.Network.ID,
+			AccountBank:   employee.BankName,
+			NetworkName:   route.Network.Name,
+			Country:       employee.Country,
+			AccountName:   accountName,
+			PhoneNumber:   employee.Phone,
+		},
+		ForceAccept:  !req.Quote,
+		CustomerType: models.CustomerTypeInstitution,
+	}
+
+	initiatedBy := req.InitiatedBy
+	if initiatedBy.IsZero() {
+		initiatedBy = user.ID
+	}
+
+	timeNow := time.Now()
+	disbursement := &models.Disbursement{
+		ID:             req.ID,
+		ReceiverID:     employee.ID,
+		SenderID:       user.ID,
+		InitiatedBy:    initiatedBy,
+		CreatedAt:      &timeNow,
+		UpdatedAt:      &timeNow,
+		SalaryAmount:   amount,
+		PaymentType:    paymentType,
+		Note:           req.Note,
+		Currency:       currency,
+		Breakdown:      &breakdown,
+		AppliedRate:    appliedRate,
+		Status:         models.DisbursementCreated,
+		PaymentRequest: &paymentRequest,
+		PayrollRunID:   req.PayrollRunID,
+		Attempt:        attempt,
+		AmountUSD:      req.routes.usdAmount(amount, currency),
+	}
+	if req.RetryOf != nil {
+		disbursement.RetryOf = req.RetryOf.ID
+	}
+	if len(split) > 1 {
+		disbursement.SplitAmounts = split
+	}
+	return disbursement, nil
+}
+
+// submit sends a created disbursement's payment request to Yellow Card. A
+// submission that failed without Yellow Card rejecting it, such as a timeout,
+// may still have reached it, so the payment is looked up by its sequenceId
+// before the disbursement is given up on. A rejected submission, or one Yellow
+// Card never received, marks the disbursement failed and returns it along with
+// the error. A split disbursement is submitted part by part.
+func (s *DisbursementService) submit(ctx context.Context, disbursement *models.Disbursement) (*models.Disbursement, error) {
+	if err := s.checkpoint(ctx, disbursement); err != nil {
+		return nil, err
+	}
+	if len(disbursement.SplitAmounts) > 0 {
+		return s.submitSplit(ctx, disbursement)
+	}
+	payment, err := s.client.SubmitPayment(*disbursement.PaymentRequest)
+	if err != nil && !pkg.IsRejection(err) {
+		payment, err = s.confirmSubmission(disbursement, err)
+	}
+	if errors.Is(err, ErrSubmissionUnconfirmed) {
+		s.logger.Warningf("disbursement [%s] left created: %v", disbursement.ID.Hex(), err)
+		return disbursement, err
+	}
+	if err != nil {
+		if _, terr := s.Transition(ctx, disbursement, models.DisbursementFailed, models.StatusSourceAPI, ""); terr != nil {
+			s.logger.Errorf("could not mark disbursement [%s] failed: %v", disbursement.ID.Hex(), terr)
+		}
+		s.scheduleRetry(ctx, disbursement, failureReason(err))
+		return disbursement, err
+	}
+	return s.submitted(ctx, disbursement, payment)
+}
+
+// confirmSubmission looks up the payment of a submission that failed with
+// submitErr. It returns the payment when Yellow Card received it after all,
+// submitErr when it never did, and ErrSubmissionUnconfirmed otherwise.
+func (s *DisbursementService) confirmSubmission(disbursement *models.Disbursement, submitErr error) (models.Payment, error) {
+	payment, err := s.client.GetPaymentBySequenceID(disbursement.PaymentRequest.SequenceID)
+	if errors.Is(err, pkg.ErrPaymentNotFound) {
+		return payment, submitErr
+	}
+	if err != nil {
+		return payment, fmt.Errorf("%w: %v; lookup: %v", ErrSubmissionUnconfirmed, submitErr, err)
+	}
+	s.logger.Noticef("disbursement [%s] reached Yellow Card as payment [%s] despite %v", disbursement.ID.Hex(), payment.ID, submitErr)
+	return payment, nil
+}
+
+// resume finishes submitting a created disbursement the process may have
+// stopped submitting. The payment is looked up by its sequenceId first, so one
+// Yellow Card already received is recorded rather than submitted again.
+func (s *DisbursementService) resume(ctx context.Context, disbursement *models.Disbursement) (*models.Disbursement, error) {
+	if disbursement.Status != models.DisbursementCreated {
+		return disbursement, nil
+	}
+	if len(disbursement.SplitAmounts) > 0 {
+		return s.submitSplit(ctx, disbursement)
+	}
+
+	payment, err := s.client.GetPaymentBySequenceID(disbursement.PaymentRequest.SequenceID)
+	if errors.Is(err, pkg.ErrPaymentNotFound) {
+		return s.submit(ctx, disbursement)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Noticef("disbursement [%s] had already reached Yellow Card as payment [%s]", disbursement.ID.Hex(), payment.ID)
+	return s.submitted(ctx, disbursement, payment)
+}
+
+// submitted records the payment Yellow Card returned for the disbursement.
+func (s *DisbursementService) submitted(ctx context.Context, disbursement *models.Disbursement, payment models.Payment) (*models.Disbursement, error) {
+	s.logger.Infof("Payment = %+v", payment)
+	if err := s.repos.Disbursement.UpdateOneById(ctx, disbursement.ID, models.Disbursement{Payment: payment}); err != nil {
+		return nil, err
+	}
+	disbursement.Payment = payment
+
+	status := models.DisbursementProcessing
+	if !disbursement.PaymentRequest.ForceAccept {
+		status = models.DisbursementQuoted
+	}
+	if _, err := s.Transition(ctx, disbursement, status, models.StatusSourceAPI, ""); err != nil && !errors.Is(err, ErrStatusConflict) {
+		return nil, err
+	}
+	return disbursement, nil
+}
+
+// FindDisbursement returns a disbursement made by the user.
+func (s *DisbursementService) FindDisbursement(ctx context.Context, userID, disbursementID primitive.ObjectID) (*models.Disbursement, error) {
+	return s.repos.Disbursement.FindOne(ctx, bson.D{
+		{Key: "_id", Value: disbursementID},
+		{Key: "sender_id", Value: userID},
+	})
+}
+
+// DisbursementFilter narrows down the disbursements returned by ListDisbursements.
+type DisbursementFilter struct {
+	Statuses     []models.DisbursementStatus
+	EmployeeID   primitive.ObjectID
+	PaymentTypes []string
+	From, To     *time.Time
+	MinAmount    *float64
+	MaxAmount    *float64
+}
+
+// ListDisbursements returns a page of the user's disbursements matching the filter.
+func (s *DisbursementService) ListDisbursements(ctx context.Context, userID primitive.ObjectID, filter DisbursementFilter, page repository.PageQuery) (*repository.Page[models.Disbursement], error) {
+	query := bson.D{
+		{Key: "sender_id", Value: userID},
+		// parts are listed with the split disbursement they belong to
+		{Key: "parent_id", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	if len(filter.Statuses) > 0 {
+		query = append(query, bson.E{Key: "status", Value: bson.D{{Key: "$in", Value: filter.Statuses}}})
+	}
+	if !filter.EmployeeID.IsZero() {
+		query = append(query, bson.E{Key: "receiver_id", Value: filter.EmployeeID})
+	}
+	if len(filter.PaymentTypes) > 0 {
+		paymentTypes := []any{}
+		for _, paymentType := range filter.PaymentTypes {
+			paymentTypes = append(paymentTypes, paymentType)
+			if paymentType == models.PaymentTypeSalary {
+				// disbursements from before payment types were all salaries
+				paymentTypes = append(paymentTypes, nil)
+			}
+		}
+		query = append(query, bson.E{Key: "payment_type", Value: bson.D{{Key: "$in", Value: paymentTypes}}})
+	}
+
+	createdAt := bson.D{}
+	if filter.From != nil {
+		createdAt = append(createdAt, bson.E{Key: "$gte", Value: *filter.From})
+	}
+	if filter.To != nil {
+		createdAt = append(createdAt, bson.E{Key: "$lte", Value: *filter.To})
+	}
+	if len(createdAt) > 0 {
+		query = append(query, bson.E{Key: "createdAt", Value: createdAt})
+	}
+
+	amount := bson.D{}
+	if filter.MinAmount != nil {
+		amount = append(amount, bson.E{Key: "$gte", Value: *filter.MinAmount})
+	}
+	if filter.MaxAmount != nil {
+		amount = append(amount, bson.E{Key: "$lte", Value: *filter.MaxAmount})
+	}
+	if len(amount) > 0 {
+		query = append(query, bson.E{Key: "salary_amount", Value: amount})
+	}
+
+	page.Filter = query
+	return s.repos.Disbursement.FindPage(ctx, page)
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"yc-backend/models"
+	"yc-backend/pkg"
+
+	"github.com/gookit/goutil/testutil/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func offCycleRequest() DisbursementRequest {
+	return DisbursementRequest{
+		User: &models.User{FirstName: "Ada", LastName: "Obi"},
+		Employee: &models.Employee{
+			FirstName:           "Tolu",
+			LastName:            "Ade",
+			Country:             "NG",
+			BankName:            "Guaranty Trust Bank",
+			AccountNumber:       "0123456789",
+			AccountVerification: &models.AccountVerification{Status: models.AccountVerified},
+			Salary:              300000,
+		},
+		PaymentType: models.PaymentTypeBonus,
+		Amount:      50000,
+		routes:      testRoutes,
+		business:    &models.Business{RegisteredName: "Obi Ventures", RegistrationNumber: "RC123"},
+	}
+}
+
+func TestPrepareOffCyclePaysAmountWithReason(t *testing.T) {
+	req := offCycleRequest()
+	req.Reason = "gifts"
+	req.Note = "Q3 bonus"
+
+	disbursement, err := (&DisbursementService{}).prepare(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentTypeBonus, disbursement.PaymentType)
+	assert.Equal(t, "Q3 bonus", disbursement.Note)
+	assert.Equal(t, 50000.0, disbursement.SalaryAmount)
+	assert.Equal(t, "gifts", disbursement.PaymentRequest.Reason)
+	assert.Nil(t, disbursement.AppliedRate)
+}
+
+func TestPrepareSalaryDefaultsTypeAndReason(t *testing.T) {
+	req := offCycleRequest()
+	req.PaymentType, req.Amount = "", 0
+
+	disbursement, err := (&DisbursementService{}).prepare(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentTypeSalary, disbursement.PaymentType)
+	assert.Equal(t, 300000.0, disbursement.SalaryAmount)
+	assert.Equal(t, models.DefaultPaymentReason, disbursement.PaymentRequest.Reason)
+}
+
+func TestRetryKeepsPaymentType(t *testing.T) {
+	first, err := (&DisbursementService{}).prepare(offCycleRequest())
+	assert.NoError(t, err)
+
+	req := offCycleRequest()
+	req.PaymentType, req.Amount = "", 0
+	req.RetryOf = first
+
+	retry, err := (&DisbursementService{}).prepare(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentTypeBonus, retry.PaymentType)
+	assert.Equal(t, 50000.0, retry.SalaryAmount)
+}
+
+func TestPrepareSendsFromBusinessProfile(t *testing.T) {
+	req := offCycleRequest()
+	req.User.Email, req.User.IdNumber, req.User.IdType = "ada@obi.ng", "A0001", "NIN"
+	req.business = &models.Business{
+		RegisteredName:     "Obi Ventures",
+		RegistrationNumber: "RC123",
+		Address:            "1 Marina",
+		City:               "Lagos",
+		Country:            "NG",
+		Email:              "pay@obi.ng",
+		Phone:              "+2348000000000",
+		IncorporatedOn:     "2019-04-01",
+	}
+
+	disbursement, err := (&DisbursementService{}).prepare(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.CustomerTypeInstitution, disbursement.PaymentRequest.CustomerType)
+	assert.Equal(t, models.Sender{
+		Name:         "Obi Ventures",
+		Phone:        "+2348000000000",
+		Country:      "NG",
+		Address:      "1 Marina, Lagos",
+		DOB:          "2019-04-01",
+		Email:        "pay@obi.ng",
+		IDNumber:     "A0001",
+		IDType:       "NIN",
+		BusinessID:   "RC123",
+		BusinessName: "Obi Ventures",
+	}, disbursement.PaymentRequest.Sender)
+}
+
+// submittingService is a service on the mock deployment of mt whose Yellow Card
+// answers payment submissions with submitStatus and lookups by sequenceId with
+// lookupStatus and lookupBody. It counts the lookups.
+func submittingService(t *testing.T, mt *mtest.T, submitStatus, lookupStatus int, lookupBody string) (*DisbursementService, *int) {
+	lookups := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/sequence-id/") {
+			lookups++
+			w.WriteHeader(lookupStatus)
+			w.Write([]byte(lookupBody))
+			return
+		}
+		w.WriteHeader(submitStatus)
+		w.Write([]byte(`{"code": "PaymentValidationError"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	svc := mockService(mt)
+	svc.client = pkg.NewYellowClient(server.URL, "key", "secret")
+	return svc, &lookups
+}
+
+func createdDisbursement() *models.Disbursement {
+	return &models.Disbursement{
+		ID:             primitive.NewObjectID(),
+		Status:         models.DisbursementCreated,
+		PaymentRequest: &models.PaymentRequest{SequenceID: "seq-1", ForceAccept: true},
+	}
+}
+
+// statusDoc answers a findAndModify of the disbursement with it in the status.
+func statusDoc(d *models.Disbursement, status models.DisbursementStatus, fields ...bson.E) bson.E {
+	doc := bson.D{
+		{Key: "_id", Value: d.ID},
+		{Key: "status", Value: status},
+		{Key: "payment_request", Value: bson.D{{Key: "sequenceid", Value: "seq-1"}, {Key: "forceaccept", Value: true}}},
+	}
+	return bson.E{Key: "value", Value: append(doc, fields...)}
+}
+
+func TestSubmitRecordsPaymentReceivedDespiteTimeout(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("gateway timeout", func(mt *mtest.T) {
+		svc, lookups := submittingService(t, mt, http.StatusGatewayTimeout, http.StatusOK, `{"id": "payment-1", "sequenceId": "seq-1"}`)
+		disbursement := createdDisbursement()
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(statusDoc(disbursement, models.DisbursementCreated)),
+			mtest.CreateSuccessResponse(statusDoc(disbursement, models.DisbursementProcessing,
+				bson.E{Key: "payment", Value: bson.D{{Key: "id", Value: "payment-1"}}})),
+		)
+
+		submitted, err := svc.submit(context.Background(), disbursement)
+
+		assert.NoErr(t, err)
+		assert.Eq(t, 1, *lookups)
+		assert.Eq(t, "payment-1", submitted.Payment.ID)
+		assert.Eq(t, models.DisbursementProcessing, submitted.Status)
+	})
+}
+
+func TestSubmitFailsOnlyWhenYellowCardNeverReceivedThePayment(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("not found after a server error", func(mt *mtest.T) {
+		svc, lookups := submittingService(t, mt, http.StatusBadGateway, http.StatusNotFound, `{"code": "NotFound"}`)
+		disbursement := createdDisbursement()
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(statusDoc(disbursement, models.DisbursementFailed)),
+			mtest.CreateSuccessResponse(statusDoc(disbursement, models.DisbursementFailed)),
+		)
+
+		failed, err := svc.submit(context.Background(), disbursement)
+
+		assert.Err(t, err)
+		assert.Eq(t, 1, *lookups)
+		assert.Eq(t, models.DisbursementFailed, failed.Status)
+	})
+
+	mt.Run("rejected", func(mt *mtest.T) {
+		svc, lookups := submittingService(t, mt, http.StatusBadRequest, http.StatusOK, `{}`)
+		disbursement := createdDisbursement()
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(statusDoc(disbursement, models.DisbursementFailed)),
+			mtest.CreateSuccessResponse(statusDoc(disbursement, models.DisbursementFailed)),
+		)
+
+		failed, err := svc.submit(context.Background(), disbursement)
+
+		assert.True(t, pkg.IsRejection(err))
+		// a rejection needs no lookup
+		assert.Eq(t, 0, *lookups)
+		assert.Eq(t, models.DisbursementFailed, failed.Status)
+	})
+}
+
+func TestSubmitLeavesUnconfirmedPaymentCreated(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("lookup fails too", func(mt *mtest.T) {
+		svc, lookups := submittingService(t, mt, http.StatusGatewayTimeout, http.StatusBadGateway, `{}`)
+		disbursement := createdDisbursement()
+
+		unconfirmed, err := svc.submit(context.Background(), disbursement)
+
+		assert.True(t, errors.Is(err, ErrSubmissionUnconfirmed))
+		assert.Eq(t, 1, *lookups)
+		assert.Eq(t, models.DisbursementCreated, unconfirmed.Status)
+		assert.Len(t, findAndModifyUpdates(mt), 0)
+	})
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"yc-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DryRunPayment is what disbursing to one employee would do.
+type DryRunPayment struct {
+	EmployeeID primitive.ObjectID `json:"employeeId"`
+	// Payload is the body that would be sent to /business/payments. A real
+	// disbursement gets a new sequenceId.
+	Payload     *models.PaymentRequest `json:"payload,omitempty"`
+	Breakdown   *models.PayBreakdown   `json:"breakdown,omitempty"`
+	AppliedRate *models.AppliedRate    `json:"appliedRate,omitempty"`
+	// SplitAmounts are the payments an amount above the channel maximum would be made in.
+	SplitAmounts     []float64 `json:"splitAmounts,omitempty"`
+	RequiresApproval bool      `json:"requiresApproval"`
+	Error            string    `json:"error,omitempty"`
+}
+
+// DryRun is the outcome of disbursing to a set of employees, worked out
+// without submitting payments or recording disbursements.
+type DryRun struct {
+	Payments []DryRunPayment `json:"payments"`
+	// Payable counts the payments that would be made; the others have an Error.
+	Payable int             `json:"payable"`
+	Total   float64         `json:"total"`
+	Balance []BalanceReport `json:"balance"`
+	// BalanceError is set when the balance does not cover the payable payments.
+	BalanceError string `json:"balanceError,omitempty"`
+}
+
+// DryRunDisbursement works out what Disburse would send for the employee.
+func (s *DisbursementService) DryRunDisbursement(ctx context.Context, req DisbursementRequest) (*DryRun, error) {
+	return s.dryRun(ctx, req, []models.Employee{*req.Employee})
+}
+
+// DryRunPayrollRun works out what a payroll run of the user would send.
+func (s *DisbursementService) DryRunPayrollRun(ctx context.Context, user *models.User) (*DryRun, error) {
+	employees, err := s.payrollEmployees(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	// a placeholder run ID makes the approval policy treat the payments as a payroll run
+	return s.dryRun(ctx, DisbursementRequest{User: user, PayrollRunID: primitive.NewObjectID()}, employees)
+}
+
+// dryRun goes through the same lookups, validations, limit checks, route
+// resolution and pay computation as a disbursement of each employee, with
+// template as the request, but only reads from Yellow Card and the database.
+// Errors particular to one employee are reported on their payment.
+func (s *DisbursementService) dryRun(ctx context.Context, template DisbursementRequest, employees []models.Employee) (*DryRun, error) {
+	business, err := s.SenderBusiness(ctx, template.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := s.loadRoutes()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DryRun{Payments: []DryRunPayment{}}
+	payloads := []models.PaymentRequest{}
+	plannedUSD := 0.0
+	for i := range employees {
+		req := template
+		req.Employee, req.routes, req.business = &employees[i], routes, business
+		payment := DryRunPayment{EmployeeID: employees[i].ID}
+
+		disbursement, err := s.prepare(req)
+		if err == nil && !req.OverrideLimits {
+			err = s.checkLimits(ctx, disbursement, plannedUSD)
+		}
+		if err == nil {
+			payment.RequiresApproval, err = s.requiresApproval(ctx, disbursement)
+		}
+		if err != nil {
+			if !IsUnpayable(err) && !errors.Is(err, ErrLimitExceeded) {
+				return nil, err
+			}
+			payment.Error = err.Error()
+			result.Payments = append(result.Payments, payment)
+			continue
+		}
+
+		payment.Payload = disbursement.PaymentRequest
+		payment.Breakdown = disbursement.Breakdown
+		payment.AppliedRate = disbursement.AppliedRate
+		payment.SplitAmounts = disbursement.SplitAmounts
+		result.Payments = append(result.Payments, payment)
+		result.Payable++
+		result.Total = round2(result.Total + disbursement.SalaryAmount)
+		plannedUSD += disbursement.AmountUSD
+		payloads = append(payloads, *disbursement.PaymentRequest)
+	}
+
+	result.Balance, err = s.Preflight(ctx, payloads)
+	var shortfall *InsufficientBalanceError
+	if errors.As(err, &shortfall) {
+		result.BalanceError = err.Error()
+	} else if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yc-backend/models"
+	"yc-backend/pkg"
+
+	"github.com/gookit/goutil/testutil/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// dryRunService is a service on the mock deployment of mt whose Yellow Card
+// pays NGN bank accounts at 1500 NGN to the USD and holds the accounts. It
+// counts the requests that are not plain reads.
+func dryRunService(t *testing.T, mt *mtest.T, accounts string) (*DisbursementService, *int) {
+	responses := map[string]string{
+		"/business/channels": `{"channels": [{"id": "ng-bank", "currency": "NGN", "country": "NG", "channelType": "bank", "rampType": "withdraw", "status": "active", "feeLocal": 100}]}`,
+		"/business/networks": `{"networks": [{"id": "gtb", "name": "Guaranty Trust Bank", "country": "NG", "status": "active", "channelIds": ["ng-bank"]}]}`,
+		"/business/rates":    `{"rates": [{"code": "NGN", "buy": 1500}]}`,
+		"/business/account":  accounts,
+	}
+	writes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writes++
+		}
+		w.Write([]byte(responses[r.URL.Path]))
+	}))
+	t.Cleanup(server.Close)
+
+	svc := mockService(mt)
+	svc.client = pkg.NewYellowClient(server.URL, "key", "secret")
+	return svc, &writes
+}
+
+func dryRunEmployee(salary float64) models.Employee {
+	return models.Employee{
+		ID:                  primitive.NewObjectID(),
+		FirstName:           "Tolu",
+		LastName:            "Ade",
+		Country:             "NG",
+		BankName:            "Guaranty Trust Bank",
+		AccountNumber:       "0123456789",
+		AccountVerification: &models.AccountVerification{Status: models.AccountVerified},
+		Salary:              salary,
+	}
+}
+
+func dryRunBusinessDoc(userID primitive.ObjectID) bson.D {
+	return bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "user_id", Value: userID},
+		{Key: "registered_name", Value: "Obi Ventures"},
+		{Key: "registration_number", Value: "RC123"},
+		{Key: "address", Value: "1 Marina"},
+		{Key: "country", Value: "NG"},
+		{Key: "email", Value: "pay@obi.ng"},
+		{Key: "phone", Value: "+2348000000000"},
+	}
+}
+
+func TestDryRunReportsEachEmployeeWithoutWriting(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("mixed employees", func(mt *mtest.T) {
+		svc, writes := dryRunService(t, mt, `{"accounts": [{"currency": "NGN", "available": 10000000}]}`)
+		user := &models.User{ID: primitive.NewObjectID(), FirstName: "Ada", LastName: "Obi"}
+
+		paid := dryRunEmployee(300000)
+		unverified := dryRunEmployee(300000)
+		unverified.AccountVerification = nil
+		// fits under the daily limit alone, but not after the first employee
+		overLimit := dryRunEmployee(600000)
+		last := dryRunEmployee(150000)
+
+		policy := bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "user_id", Value: user.ID},
+			{Key: "business", Value: bson.D{{Key: "daily", Value: 500.0}}},
+		}
+		limitChecked := []bson.D{
+			mtest.CreateCursorResponse(0, "yc.spending_limits", mtest.FirstBatch, policy),
+			mtest.CreateCursorResponse(0, "yc.spending_counters", mtest.FirstBatch, counterDoc(0)),
+		}
+		noApprovalPolicy := mtest.CreateCursorResponse(0, "yc.approval_policies", mtest.FirstBatch)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "yc.businesses", mtest.FirstBatch, dryRunBusinessDoc(user.ID)))
+		mt.AddMockResponses(append(limitChecked, noApprovalPolicy)...)
+		mt.AddMockResponses(limitChecked...)
+		mt.AddMockResponses(append(limitChecked, noApprovalPolicy)...)
+
+		result, err := svc.dryRun(context.Background(), DisbursementRequest{User: user},
+			[]models.Employee{paid, unverified, overLimit, last})
+
+		assert.NoErr(t, err)
+		assert.Len(t, result.Payments, 4)
+		assert.Eq(t, 2, result.Payable)
+		assert.Eq(t, 450000.0, result.Total)
+		assert.Eq(t, "", result.BalanceError)
+
+		assert.Eq(t, paid.ID, result.Payments[0].EmployeeID)
+		assert.Eq(t, "", result.Payments[0].Error)
+		assert.Eq(t, 300000.0, result.Payments[0].Payload.LocalAmount)
+
+		assert.Eq(t, unverified.ID, result.Payments[1].EmployeeID)
+		assert.StrContains(t, result.Payments[1].Error, ErrAccountNotVerified.Error())
+		assert.Nil(t, result.Payments[1].Payload)
+
+		// the business daily spend counts the 200 USD planned for the first employee
+		assert.Eq(t, overLimit.ID, result.Payments[2].EmployeeID)
+		assert.StrContains(t, result.Payments[2].Error, ErrLimitExceeded.Error())
+		assert.StrContains(t, result.Payments[2].Error, "amount 400.00 on top of 200.00 already disbursed")
+		assert.Nil(t, result.Payments[2].Payload)
+
+		assert.Eq(t, last.ID, result.Payments[3].EmployeeID)
+		assert.Eq(t, "", result.Payments[3].Error)
+
+		assert.Eq(t, 0, *writes)
+		for _, event := range mt.GetAllStartedEvents() {
+			assert.Eq(t, "find", event.CommandName)
+		}
+	})
+}
+
+func TestDryRunReportsBalanceShortfall(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("short of NGN", func(mt *mtest.T) {
+		svc, writes := dryRunService(t, mt, `{"accounts": [{"currency": "NGN", "available": 100000}]}`)
+		user := &models.User{ID: primitive.NewObjectID()}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "yc.businesses", mtest.FirstBatch, dryRunBusinessDoc(user.ID)),
+			// no spending limits nor approval policy
+			mtest.CreateCursorResponse(0, "yc.spending_limits", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "yc.approval_policies", mtest.FirstBatch),
+		)
+
+		result, err := svc.dryRun(context.Background(), DisbursementRequest{User: user},
+			[]models.Employee{dryRunEmployee(300000)})
+
+		assert.NoErr(t, err)
+		assert.Eq(t, 1, result.Payable)
+		assert.StrContains(t, result.BalanceError, ErrInsufficientBalance.Error())
+		assert.Len(t, result.Balance, 1)
+		assert.Eq(t, 200100.0, result.Balance[0].Shortfall)
+		assert.Eq(t, 0, *writes)
+	})
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"yc-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PaymentEstimate is what paying one employee is expected to cost.
+type PaymentEstimate struct {
+	EmployeeID primitive.ObjectID `json:"employeeId"`
+	ChannelID  string             `json:"channelId,omitempty"`
+	Currency   string             `json:"currency,omitempty"`
+	Amount     float64            `json:"amount"`
+	// Parts is the number of payments the amount is made in; an amount above
+	// the channel's Max is split, and each part pays the fee.
+	Parts  int     `json:"parts"`
+	Fee    float64 `json:"fee"`
+	FeeUSD float64 `json:"feeUSD"`
+	Total  float64 `json:"total"`
+	// Rate is the Yellow Card rate of Currency against USD, and AmountUSD the
+	// total converted at it. Both are zero when Yellow Card has no rate.
+	Rate      float64 `json:"rate,omitempty"`
+	AmountUSD float64 `json:"amountUSD,omitempty"`
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+	// OutsideLimits is set when the amount is below the channel's Min, which
+	// cannot be paid, or above its Max, which is paid in several parts.
+	OutsideLimits bool   `json:"outsideLimits"`
+	Error         string `json:"error,omitempty"`
+}
+
+// EstimateTotal sums the estimates paid in one currency.
+type EstimateTotal struct {
+	Currency  string  `json:"currency"`
+	Payments  int     `json:"payments"`
+	Amount    float64 `json:"amount"`
+	Fees      float64 `json:"fees"`
+	FeesUSD   float64 `json:"feesUSD"`
+	Total     float64 `json:"total"`
+	AmountUSD float64 `json:"amountUSD,omitempty"`
+}
+
+// Estimate previews the cost of paying a set of employees.
+type Estimate struct {
+	Payments []PaymentEstimate `json:"payments"`
+	Totals   []EstimateTotal   `json:"totals"`
+	// TotalUSD sums AmountUSD over every currency Yellow Card has a rate for.
+	TotalUSD float64 `json:"totalUSD"`
+	// OutsideLimits counts the employees flagged as outside their channel's limits.
+	OutsideLimits int `json:"outsideLimits"`
+}
+
+// EstimatePayroll previews the cost of paying the employee, or the user's whole
+// workforce when employee is nil, from the current Yellow Card channels and
+// rates. Nothing is recorded and no limits or balances are checked.
+func (s *DisbursementService) EstimatePayroll(ctx context.Context, user *models.User, employee *models.Employee) (*Estimate, error) {
+	var employees []models.Employee
+	if employee != nil {
+		employees = []models.Employee{*employee}
+	} else {
+		var err error
+		if employees, err = s.payrollEmployees(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	routes, err := s.loadRoutes()
+	if err != nil {
+		return nil, err
+	}
+	return routes.estimate(employees)
+}
+
+// estimate works out each employee's pay and fees. Errors particular to one
+// employee are reported on their estimate.
+func (r *paymentRoutes) estimate(employees []models.Employee) (*Estimate, error) {
+	result := &Estimate{Payments: []PaymentEstimate{}, Totals: []EstimateTotal{}}
+	totals := map[string]*EstimateTotal{}
+	currencies := []string{}
+
+	for i := range employees {
+		employee := &employees[i]
+		estimate := PaymentEstimate{EmployeeID: employee.ID}
+
+		route, err := r.resolve(employee)
+		var breakdown models.PayBreakdown
+		if err == nil {
+			breakdown, _, err = r.pay(employee, route.Channel.Currency)
+		}
+		if err != nil {
+			if !IsUnpayable(err) {
+				return nil, err
+			}
+			estimate.Error = err.Error()
+			result.Payments = append(result.Payments, estimate)
+			continue
+		}
+
+		channel := route.Channel
+		estimate.ChannelID = channel.ID
+		estimate.Currency = channel.Currency
+		estimate.Amount = breakdown.Net
+		estimate.Parts = paymentParts(estimate.Amount, channel)
+		estimate.Fee = float64(channel.FeeLocal * estimate.Parts)
+		estimate.FeeUSD = round2(channel.FeeUSD * float64(estimate.Parts))
+		estimate.Total = round2(estimate.Amount + estimate.Fee)
+		estimate.Min, estimate.Max = channel.Min, channel.Max
+		estimate.OutsideLimits = outsideChannelLimits(channel.Min, channel.Max, estimate.Amount)
+		if rate, err := r.rate(channel.Currency); err == nil {
+			estimate.Rate = rate.Buy
+			estimate.AmountUSD = round2(estimate.Total / rate.Buy)
+		}
+		if estimate.OutsideLimits {
+			result.OutsideLimits++
+		}
+		result.Payments = append(result.Payments, estimate)
+
+		total, ok := totals[estimate.Currency]
+		if !ok {
+			total = &EstimateTotal{Currency: estimate.Currency}
+			totals[estimate.Currency] = total
+			currencies = append(currencies, estimate.Currency)
+		}
+		total.Payments += estimate.Parts
+		total.Amount = round2(total.Amount + estimate.Amount)
+		total.Fees = round2(total.Fees + estimate.Fee)
+		total.FeesUSD = round2(total.FeesUSD + estimate.FeeUSD)
+		total.Total = round2(total.Total + estimate.Total)
+		total.AmountUSD = round2(total.AmountUSD + estimate.AmountUSD)
+	}
+
+	for _, currency := range currencies {
+		result.Totals = append(result.Totals, *totals[currency])
+		result.TotalUSD = round2(result.TotalUSD + totals[currency].AmountUSD)
+	}
+	return result, nil
+}
+
+// outsideChannelLimits reports whether the amount cannot be paid through a
+// channel in one payment. A zero Max means the channel has no upper limit.
+func outsideChannelLimits(min, max, amount float64) bool {
+	return amount < min || (max > 0 && amount > max)
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+	"yc-backend/models"
+	"yc-backend/pkg"
+
+	"github.com/gookit/goutil/testutil/assert"
+)
+
+func TestEstimateTotalsFeesAndFlagsChannelLimits(t *testing.T) {
+	routes := &paymentRoutes{
+		channels: []pkg.Channel{
+			{ID: "ng-bank", Country: "NG", Currency: "NGN", ChannelType: "bank", RampType: "withdraw", Status: "active", FeeLocal: 100, FeeUSD: 0.07, Min: 1000, Max: 500000},
+		},
+		networks: testRoutes.networks,
+	}
+	routes.ratesOnce.Do(func() {
+		routes.rates = []pkg.Rate{{Code: "NGN", Buy: 1500}}
+	})
+
+	estimate, err := routes.estimate([]models.Employee{
+		{Country: "NG", BankName: "Guaranty Trust Bank", Salary: 149900},
+		{Country: "NG", BankName: "Guaranty Trust Bank", Salary: 900000},
+		{Country: "GH", BankName: "GCB Bank", Salary: 5000},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, estimate.Payments, 3)
+
+	assert.Equal(t, 100.0, estimate.Payments[0].Fee)
+	assert.Equal(t, 150000.0, estimate.Payments[0].Total)
+	assert.Equal(t, 100.0, estimate.Payments[0].AmountUSD)
+	assert.False(t, estimate.Payments[0].OutsideLimits)
+	assert.True(t, estimate.Payments[1].OutsideLimits)
+	assert.Equal(t, 2, estimate.Payments[1].Parts)
+	assert.Equal(t, 200.0, estimate.Payments[1].Fee)
+	assert.NotEmpty(t, estimate.Payments[2].Error)
+
+	assert.Equal(t, 1, estimate.OutsideLimits)
+	assert.Len(t, estimate.Totals, 1)
+	assert.Equal(t, 3, estimate.Totals[0].Payments)
+	assert.Equal(t, 300.0, estimate.Totals[0].Fees)
+	assert.Equal(t, 1050200.0, estimate.Totals[0].Total)
+	assert.Equal(t, 700.13, estimate.TotalUSD)
+}
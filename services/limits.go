@@ -0,0 +1,355 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"yc-backend/models"
+
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrLimitExceeded = errors.New("spending limit exceeded")
+	ErrLimitsRaised  = errors.New("only admins can raise or remove spending limits")
+)
+
+const (
+	LimitScopeBusiness = "business"
+	LimitScopeEmployee = "employee"
+
+	LimitPerTransaction = "per_transaction"
+	LimitDaily          = "daily"
+	LimitMonthly        = "monthly"
+)
+
+// LimitExceededError describes which spending limit a disbursement would break.
+// Amounts are in USD.
+type LimitExceededError struct {
+	Scope  string
+	Period string
+	Limit  float64
+	// Spent is what has already been disbursed in the period.
+	Spent  float64
+	Amount float64
+}
+
+func (e *LimitExceededError) Error() string {
+	if e.Period == LimitPerTransaction {
+		return fmt.Sprintf("%s: amount %.2f is over the %s per-transaction limit of %.2f %s",
+			ErrLimitExceeded, e.Amount, e.Scope, e.Limit, USD)
+	}
+	return fmt.Sprintf("%s: amount %.2f on top of %.2f already disbursed is over the %s %s limit of %.2f %s",
+		ErrLimitExceeded, e.Amount, e.Spent, e.Scope, e.Period, e.Limit, USD)
+}
+
+func (e *LimitExceededError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// uncountedStatuses are not counted against the limits: no money left the
+// business for them.
+var uncountedStatuses = []models.DisbursementStatus{
+	models.DisbursementFailed,
+	models.DisbursementRejected,
+	models.DisbursementDenied,
+	models.DisbursementExpired,
+}
+
+// countsAgainstLimits reports whether a disbursement in the status is counted
+// against the spending limits.
+func countsAgainstLimits(status models.DisbursementStatus) bool {
+	return !lo.Contains(uncountedStatuses, status)
+}
+
+// SpendingLimitPolicy returns the spending limits of the business, falling
+// back to the configured defaults when it has no policy of its own.
+func (s *DisbursementService) SpendingLimitPolicy(ctx context.Context, businessID primitive.ObjectID) (*models.SpendingLimitPolicy, error) {
+	policy, err := s.repos.SpendLimit.FindOne(ctx, bson.D{{Key: "user_id", Value: businessID}})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &models.SpendingLimitPolicy{
+			UserID:   businessID,
+			Business: s.cfg.SpendingLimits.Business,
+			Employee: s.cfg.SpendingLimits.Employee,
+		}, nil
+	}
+	return policy, err
+}
+
+// SaveSpendingLimitPolicy stores the spending limits of the business. Unless
+// asAdmin is set, the new limits may only be stricter than the current ones,
+// so a compromised account cannot lift its own guardrails.
+func (s *DisbursementService) SaveSpendingLimitPolicy(ctx context.Context, policy models.SpendingLimitPolicy, asAdmin bool) (*models.SpendingLimitPolicy, error) {
+	current, err := s.SpendingLimitPolicy(ctx, policy.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !asAdmin && !limitsWithin(policy, *current) {
+		return nil, ErrLimitsRaised
+	}
+
+	timeNow := time.Now()
+	policy.UpdatedAt = &timeNow
+	if current.ID.IsZero() {
+		policy.CreatedAt = &timeNow
+		id, err := s.repos.SpendLimit.Create(ctx, policy)
+		if err != nil {
+			return nil, err
+		}
+		if policyId, ok := id.(primitive.ObjectID); ok {
+			policy.ID = policyId
+		}
+		return &policy, nil
+	}
+
+	policy.ID = current.ID
+	if err := s.repos.SpendLimit.UpdateOneById(ctx, current.ID, policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// limitsWithin reports whether no limit of next is looser than in current.
+func limitsWithin(next, current models.SpendingLimitPolicy) bool {
+	if !next.Business.Within(current.Business) || !next.Employee.Within(current.Employee) {
+		return false
+	}
+	for _, override := range next.Employees {
+		if !override.Limits.Within(current.EmployeeLimits(override.EmployeeID)) {
+			return false
+		}
+	}
+	// dropping an override falls back to the default employee limits
+	for _, override := range current.Employees {
+		if !next.EmployeeLimits(override.EmployeeID).Within(override.Limits) {
+			return false
+		}
+	}
+	return true
+}
+
+// limitCounter is a spending counter a disbursement is counted on, with the
+// limit that applies to it.
+type limitCounter struct {
+	scope, period string
+	ownerID       primitive.ObjectID
+	since         time.Time
+	limit         float64
+}
+
+func (c limitCounter) filter() bson.D {
+	return bson.D{
+		{Key: "scope", Value: c.scope},
+		{Key: "owner_id", Value: c.ownerID},
+		{Key: "period", Value: c.period},
+		{Key: "period_start", Value: c.since},
+	}
+}
+
+// limitCounters lists the counters of the business and of the employee the
+// disbursement is counted on, with their limits under the policy. A nil policy
+// leaves every counter unlimited.
+func limitCounters(policy *models.SpendingLimitPolicy, disbursement *models.Disbursement) []limitCounter {
+	var business, employee models.SpendingLimits
+	if policy != nil {
+		business, employee = policy.Business, policy.EmployeeLimits(disbursement.ReceiverID)
+	}
+	dayStart, monthStart := periodStarts(*disbursement.CreatedAt)
+	return []limitCounter{
+		{LimitScopeBusiness, LimitDaily, disbursement.SenderID, dayStart, business.Daily},
+		{LimitScopeBusiness, LimitMonthly, disbursement.SenderID, monthStart, business.Monthly},
+		{LimitScopeEmployee, LimitDaily, disbursement.ReceiverID, dayStart, employee.Daily},
+		{LimitScopeEmployee, LimitMonthly, disbursement.ReceiverID, monthStart, employee.Monthly},
+	}
+}
+
+// checkPerTransaction refuses a disbursement above a per-transaction limit.
+// Limits are set in USD, so a disbursement without a USD amount cannot be
+// checked against them.
+func checkPerTransaction(policy *models.SpendingLimitPolicy, disbursement *models.Disbursement) error {
+	business, employee := policy.Business, policy.EmployeeLimits(disbursement.ReceiverID)
+	if disbursement.AmountUSD <= 0 {
+		if business == (models.SpendingLimits{}) && employee == (models.SpendingLimits{}) {
+			return nil
+		}
+		return fmt.Errorf("%w: spending limits are set in %s", ErrNoRate, USD)
+	}
+
+	amount := disbursement.AmountUSD
+	if business.PerTransaction > 0 && amount > business.PerTransaction {
+		return &LimitExceededError{Scope: LimitScopeBusiness, Period: LimitPerTransaction, Limit: business.PerTransaction, Amount: amount}
+	}
+	if employee.PerTransaction > 0 && amount > employee.PerTransaction {
+		return &LimitExceededError{Scope: LimitScopeEmployee, Period: LimitPerTransaction, Limit: employee.PerTransaction, Amount: amount}
+	}
+	return nil
+}
+
+// reserveLimits counts the disbursement on its spending counters, or refuses it
+// with a *LimitExceededError when that would take one over its limit. A counter
+// is only incremented while it stays within its limit, so concurrent
+// disbursements cannot both fit under a limit only one of them fits under,
+// whichever process they run in. Overridden disbursements are counted but never
+// refused.
+func (s *DisbursementService) reserveLimits(ctx context.Context, disbursement *models.Disbursement, overrideLimits bool) error {
+	policy, err := s.SpendingLimitPolicy(ctx, disbursement.SenderID)
+	if err != nil {
+		return err
+	}
+	if !overrideLimits {
+		if err := checkPerTransaction(policy, disbursement); err != nil {
+			return err
+		}
+	}
+
+	amount := disbursement.AmountUSD
+	counters := limitCounters(policy, disbursement)
+	for i, counter := range counters {
+		if err := s.seedCounter(ctx, counter); err != nil {
+			s.unreserve(ctx, counters[:i], amount)
+			return err
+		}
+
+		filter := counter.filter()
+		if !overrideLimits && counter.limit > 0 {
+			filter = append(filter, bson.E{Key: "spent", Value: bson.D{{Key: "$lte", Value: counter.limit - amount}}})
+		}
+		_, err := s.repos.SpendCounter.FindOneAndUpdate(ctx, filter,
+			bson.D{{Key: "$inc", Value: bson.D{{Key: "spent", Value: amount}}}})
+		if err == nil {
+			continue
+		}
+
+		s.unreserve(ctx, counters[:i], amount)
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+		spent, err := s.counterSpent(ctx, counter)
+		if err != nil {
+			return err
+		}
+		return &LimitExceededError{Scope: counter.scope, Period: counter.period, Limit: counter.limit, Spent: spent, Amount: amount}
+	}
+	return nil
+}
+
+// releaseLimits takes a disbursement no money left the business for off its
+// spending counters. Parts of a split disbursement are counted on their parent.
+func (s *DisbursementService) releaseLimits(ctx context.Context, disbursement *models.Disbursement) {
+	if !disbursement.ParentID.IsZero() || disbursement.CreatedAt == nil || disbursement.AmountUSD <= 0 {
+		return
+	}
+	s.unreserve(ctx, limitCounters(nil, disbursement), disbursement.AmountUSD)
+}
+
+func (s *DisbursementService) unreserve(ctx context.Context, counters []limitCounter, amount float64) {
+	for _, counter := range counters {
+		if _, err := s.repos.SpendCounter.FindOneAndUpdate(context.WithoutCancel(ctx), counter.filter(),
+			bson.D{{Key: "$inc", Value: bson.D{{Key: "spent", Value: -amount}}}}); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			s.logger.Errorf("could not release %.2f %s from the %s %s spending of [%s]: %v",
+				amount, USD, counter.scope, counter.period, counter.ownerID.Hex(), err)
+		}
+	}
+}
+
+// seedCounter creates a missing counter from the disbursements recorded in its
+// period before it, such as those created before counters were kept.
+func (s *DisbursementService) seedCounter(ctx context.Context, counter limitCounter) error {
+	_, err := s.repos.SpendCounter.FindOne(ctx, counter.filter())
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+	spent, err := s.recordedSpend(ctx, counter)
+	if err != nil {
+		return err
+	}
+
+	timeNow := time.Now()
+	_, err = s.repos.SpendCounter.Create(ctx, models.SpendingCounter{
+		Scope:       counter.scope,
+		OwnerID:     counter.ownerID,
+		Period:      counter.period,
+		PeriodStart: counter.since,
+		Spent:       spent,
+		CreatedAt:   &timeNow,
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		// seeded concurrently
+		return nil
+	}
+	return err
+}
+
+// counterSpent returns what the counter holds, without creating it.
+func (s *DisbursementService) counterSpent(ctx context.Context, counter limitCounter) (float64, error) {
+	stored, err := s.repos.SpendCounter.FindOne(ctx, counter.filter())
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return s.recordedSpend(ctx, counter)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return stored.Spent, nil
+}
+
+// recordedSpend sums the USD amounts of the disbursements counted on the counter.
+func (s *DisbursementService) recordedSpend(ctx context.Context, counter limitCounter) (float64, error) {
+	owner := "sender_id"
+	if counter.scope == LimitScopeEmployee {
+		owner = "receiver_id"
+	}
+	return s.repos.Disbursement.Sum(ctx, bson.D{
+		{Key: owner, Value: counter.ownerID},
+		{Key: "parent_id", Value: bson.D{{Key: "$exists", Value: false}}},
+		{Key: "status", Value: bson.D{{Key: "$nin", Value: uncountedStatuses}}},
+		{Key: "createdAt", Value: bson.D{{Key: "$gte", Value: counter.since}}},
+	}, "amount_usd")
+}
+
+// checkLimits returns a *LimitExceededError when the disbursement would take
+// the business or the employee over one of their limits, without counting it.
+// plannedUSD is what the business is about to disburse on top of what is
+// recorded, as in a dry run of a payroll.
+func (s *DisbursementService) checkLimits(ctx context.Context, disbursement *models.Disbursement, plannedUSD float64) error {
+	policy, err := s.SpendingLimitPolicy(ctx, disbursement.SenderID)
+	if err != nil {
+		return err
+	}
+	if err := checkPerTransaction(policy, disbursement); err != nil {
+		return err
+	}
+
+	amount := disbursement.AmountUSD
+	for _, counter := range limitCounters(policy, disbursement) {
+		if counter.limit <= 0 {
+			continue
+		}
+		spent, err := s.counterSpent(ctx, counter)
+		if err != nil {
+			return err
+		}
+		if counter.scope == LimitScopeBusiness {
+			spent += plannedUSD
+		}
+		if spent+amount > counter.limit {
+			return &LimitExceededError{Scope: counter.scope, Period: counter.period, Limit: counter.limit, Spent: spent, Amount: amount}
+		}
+	}
+	return nil
+}
+
+// periodStarts returns the start of the day and of the month of t in the
+// payroll timezone.
+func periodStarts(t time.Time) (day, month time.Time) {
+	loc, err := time.LoadLocation(DefaultPayTimezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc),
+		time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+}
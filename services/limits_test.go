@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"yc-backend/common"
+	"yc-backend/internals"
+	"yc-backend/models"
+	"yc-backend/repository"
+
+	"github.com/gookit/goutil/testutil/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestLimitsWithinAllowsTighteningOnly(t *testing.T) {
+	current := models.SpendingLimitPolicy{
+		Business: models.SpendingLimits{Daily: 1000000},
+		Employee: models.SpendingLimits{PerTransaction: 500000},
+	}
+
+	tighter := current
+	tighter.Business = models.SpendingLimits{Daily: 800000, Monthly: 5000000}
+	assert.True(t, limitsWithin(tighter, current))
+
+	raised := current
+	raised.Business = models.SpendingLimits{Daily: 2000000}
+	assert.False(t, limitsWithin(raised, current))
+
+	removed := current
+	removed.Employee = models.SpendingLimits{}
+	assert.False(t, limitsWithin(removed, current))
+}
+
+func TestLimitsWithinChecksEmployeeOverrides(t *testing.T) {
+	employeeID := primitive.NewObjectID()
+	current := models.SpendingLimitPolicy{
+		Employee: models.SpendingLimits{PerTransaction: 500000},
+		Employees: []models.EmployeeSpendingLimits{
+			{EmployeeID: employeeID, Limits: models.SpendingLimits{PerTransaction: 100000}},
+		},
+	}
+
+	loosened := current
+	loosened.Employees = []models.EmployeeSpendingLimits{
+		{EmployeeID: employeeID, Limits: models.SpendingLimits{PerTransaction: 200000}},
+	}
+	assert.False(t, limitsWithin(loosened, current))
+
+	dropped := current
+	dropped.Employees = nil
+	assert.False(t, limitsWithin(dropped, current))
+}
+
+func TestLimitExceededErrorIsErrLimitExceeded(t *testing.T) {
+	var err error = &LimitExceededError{Scope: LimitScopeBusiness, Period: LimitDaily, Limit: 1000, Spent: 800, Amount: 300}
+
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+	assert.Contains(t, err.Error(), "business daily limit of 1000.00")
+}
+
+func TestPeriodStartsUsePayrollTimezone(t *testing.T) {
+	// 23:30 UTC on the last day of January is already February 1st in Lagos
+	day, month := periodStarts(time.Date(2024, time.January, 31, 23, 30, 0, 0, time.UTC))
+
+	assert.Equal(t, time.Date(2024, time.January, 31, 23, 0, 0, 0, time.UTC), day.UTC())
+	assert.Equal(t, time.Date(2024, time.January, 31, 23, 0, 0, 0, time.UTC), month.UTC())
+}
+
+// mockService is a DisbursementService on the mock deployment of mt.
+func mockService(mt *mtest.T) *DisbursementService {
+	return &DisbursementService{
+		cfg:    &common.Config{},
+		repos:  repository.InitRepositories(mt.DB),
+		logger: internals.GetLogger(),
+	}
+}
+
+func counterDoc(spent float64) bson.D {
+	return bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "spent", Value: spent}}
+}
+
+func limitedDisbursement() *models.Disbursement {
+	createdAt := time.Now()
+	return &models.Disbursement{
+		SenderID:   primitive.NewObjectID(),
+		ReceiverID: primitive.NewObjectID(),
+		CreatedAt:  &createdAt,
+		AmountUSD:  20,
+	}
+}
+
+func findAndModifyUpdates(mt *mtest.T) []bson.Raw {
+	updates := []bson.Raw{}
+	for _, event := range mt.GetAllStartedEvents() {
+		if event.CommandName == "findAndModify" {
+			updates = append(updates, event.Command)
+		}
+	}
+	return updates
+}
+
+func TestReserveLimitsOnlyIncrementsWithinTheLimit(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("over the business daily limit", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "yc.spending_limits", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "business", Value: bson.D{{Key: "daily", Value: 100.0}}},
+			}),
+			mtest.CreateCursorResponse(0, "yc.spending_counters", mtest.FirstBatch, counterDoc(90)),
+			// no counter matched the condition
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			mtest.CreateCursorResponse(0, "yc.spending_counters", mtest.FirstBatch, counterDoc(90)),
+		)
+
+		err := mockService(mt).reserveLimits(context.Background(), limitedDisbursement(), false)
+
+		var exceeded *LimitExceededError
+		assert.True(t, errors.As(err, &exceeded))
+		assert.Equal(t, LimitExceededError{Scope: LimitScopeBusiness, Period: LimitDaily, Limit: 100, Spent: 90, Amount: 20}, *exceeded)
+
+		updates := findAndModifyUpdates(mt)
+		assert.Len(t, updates, 1)
+		spent := updates[0].Lookup("query", "spent", "$lte")
+		assert.Equal(t, 80.0, spent.Double())
+	})
+}
+
+func TestReserveLimitsReleasesCountersAlreadyIncremented(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("over the employee daily limit", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "yc.spending_limits", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "employee", Value: bson.D{{Key: "daily", Value: 100.0}}},
+			}),
+			mtest.CreateCursorResponse(0, "yc.spending_counters", mtest.FirstBatch, counterDoc(10)),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: counterDoc(30)}),
+			mtest.CreateCursorResponse(0, "yc.spending_counters", mtest.FirstBatch, counterDoc(10)),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: counterDoc(30)}),
+			mtest.CreateCursorResponse(0, "yc.spending_counters", mtest.FirstBatch, counterDoc(95)),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			// the business counters are given back
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: counterDoc(10)}),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: counterDoc(10)}),
+			mtest.CreateCursorResponse(0, "yc.spending_counters", mtest.FirstBatch, counterDoc(95)),
+		)
+
+		err := mockService(mt).reserveLimits(context.Background(), limitedDisbursement(), false)
+
+		assert.True(t, errors.Is(err, ErrLimitExceeded))
+		updates := findAndModifyUpdates(mt)
+		assert.Len(t, updates, 5)
+		for i, inc := range []float64{20, 20, 20, -20, -20} {
+			assert.Equal(t, inc, updates[i].Lookup("update", "$inc", "spent").Double())
+		}
+		assert.Equal(t, LimitScopeBusiness, updates[3].Lookup("query", "scope").StringValue())
+		assert.Equal(t, LimitDaily, updates[3].Lookup("query", "period").StringValue())
+		assert.Equal(t, LimitMonthly, updates[4].Lookup("query", "period").StringValue())
+	})
+}
+
+func TestLimitsNeedAUSDAmount(t *testing.T) {
+	policy := &models.SpendingLimitPolicy{Employee: models.SpendingLimits{Monthly: 1000}}
+	disbursement := limitedDisbursement()
+	disbursement.AmountUSD = 0
+
+	assert.True(t, errors.Is(checkPerTransaction(policy, disbursement), ErrNoRate))
+	assert.NoError(t, checkPerTransaction(&models.SpendingLimitPolicy{}, disbursement))
+}
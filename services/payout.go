@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"yc-backend/models"
+	"yc-backend/pkg"
+)
+
+var ErrInvalidAccountNumber = errors.New("invalid account number")
+
+// Yellow Card networks take either bank account numbers or phone numbers.
+const (
+	bankAccountNumberType  = "bank"
+	phoneAccountNumberType = "phone"
+)
+
+type phonePlan struct {
+	dialingCode string
+	// digits is the length of a national number without its leading zero
+	digits int
+}
+
+// phonePlans are the numbering plans of the countries Yellow Card pays mobile
+// money out in.
+var phonePlans = map[string]phonePlan{
+	"NG": {dialingCode: "234", digits: 10},
+	"GH": {dialingCode: "233", digits: 9},
+	"KE": {dialingCode: "254", digits: 9},
+	"UG": {dialingCode: "256", digits: 9},
+	"TZ": {dialingCode: "255", digits: 9},
+	"RW": {dialingCode: "250", digits: 9},
+	"ZM": {dialingCode: "260", digits: 9},
+	"MW": {dialingCode: "265", digits: 9},
+	"CM": {dialingCode: "237", digits: 9},
+	"SN": {dialingCode: "221", digits: 9},
+	"CI": {dialingCode: "225", digits: 10},
+	"BJ": {dialingCode: "229", digits: 8},
+	"TG": {dialingCode: "228", digits: 8},
+}
+
+// PayoutMethod returns the employee's payout method, bank unless set.
+func PayoutMethod(employee *models.Employee) string {
+	if method := strings.ToLower(employee.AccountType); method != "" {
+		return method
+	}
+	return models.PayoutBank
+}
+
+// NormalizeAccountNumber validates the account number of the payout method in
+// the country and returns it in the form Yellow Card expects: the digits of a
+// bank account number, or a mobile number in international format.
+func NormalizeAccountNumber(method, country, accountNumber string) (string, error) {
+	switch method {
+	case models.PayoutBank:
+		number := strings.ReplaceAll(strings.TrimSpace(accountNumber), " ", "")
+		if number == "" || strings.IndexFunc(number, func(r rune) bool { return !unicode.IsDigit(r) }) >= 0 {
+			return "", fmt.Errorf("%w: bank account numbers are digits only", ErrInvalidAccountNumber)
+		}
+		if strings.EqualFold(country, "NG") && len(number) != 10 {
+			return "", fmt.Errorf("%w: Nigerian bank account numbers have 10 digits", ErrInvalidAccountNumber)
+		}
+		return number, nil
+	case models.PayoutMomo:
+		return normalizePhoneNumber(country, accountNumber)
+	default:
+		return "", fmt.Errorf("unknown payout method [%s], expected %s or %s", method, models.PayoutBank, models.PayoutMomo)
+	}
+}
+
+// normalizePhoneNumber accepts a national number, with or without its leading
+// zero, or an international one, and returns it as +<dialing code><number>.
+func normalizePhoneNumber(country, phone string) (string, error) {
+	plan, ok := phonePlans[strings.ToUpper(country)]
+	if !ok {
+		return "", fmt.Errorf("%w: mobile money is not supported in country [%s]", ErrInvalidAccountNumber, country)
+	}
+
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+	digits = strings.TrimPrefix(digits, "00")
+	switch {
+	case strings.HasPrefix(digits, plan.dialingCode) && len(digits) == len(plan.dialingCode)+plan.digits:
+		digits = digits[len(plan.dialingCode):]
+	case strings.HasPrefix(digits, "0") && len(digits) == plan.digits+1:
+		digits = digits[1:]
+	}
+	if len(digits) != plan.digits {
+		return "", fmt.Errorf("%w: [%s] is not a mobile number in country [%s]", ErrInvalidAccountNumber, phone, country)
+	}
+	return "+" + plan.dialingCode + digits, nil
+}
+
+// accountNumberTypeOf is the account number type of the payout method's networks.
+func accountNumberTypeOf(method string) string {
+	if method == models.PayoutMomo {
+		return phoneAccountNumberType
+	}
+	return bankAccountNumberType
+}
+
+// takesAccountNumbersOf reports whether the network accepts the account
+// numbers of the payout method. Networks that do not say are assumed to.
+func takesAccountNumbersOf(network pkg.Network, method string) bool {
+	return network.AccountNumberType == "" || strings.EqualFold(network.AccountNumberType, accountNumberTypeOf(method))
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"yc-backend/models"
+	"yc-backend/pkg"
+
+	"github.com/gookit/goutil/testutil/assert"
+)
+
+func TestNormalizeMomoNumbers(t *testing.T) {
+	for _, phone := range []string{"0241234567", "241234567", "+233 24 123 4567", "00233241234567"} {
+		number, err := NormalizeAccountNumber(models.PayoutMomo, "GH", phone)
+		assert.NoError(t, err)
+		assert.Equal(t, "+233241234567", number)
+	}
+
+	_, err := NormalizeAccountNumber(models.PayoutMomo, "KE", "07123")
+	assert.True(t, errors.Is(err, ErrInvalidAccountNumber))
+
+	_, err = NormalizeAccountNumber(models.PayoutMomo, "FR", "0612345678")
+	assert.True(t, errors.Is(err, ErrInvalidAccountNumber))
+}
+
+func TestNormalizeBankAccountNumbers(t *testing.T) {
+	number, err := NormalizeAccountNumber(models.PayoutBank, "NG", "0123 456789")
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789", number)
+
+	_, err = NormalizeAccountNumber(models.PayoutBank, "NG", "12345")
+	assert.True(t, errors.Is(err, ErrInvalidAccountNumber))
+
+	_, err = NormalizeAccountNumber("wire", "NG", "0123456789")
+	assert.Error(t, err)
+}
+
+func TestResolveMomoRouteUsesPhoneNetworks(t *testing.T) {
+	routes := &paymentRoutes{
+		channels: []pkg.Channel{
+			{ID: "gh-momo", Country: "GH", ChannelType: "momo", RampType: "withdraw", Status: "active"},
+		},
+		networks: []pkg.Network{
+			{ID: "mtn-bank", Name: "MTN", Country: "GH", Status: "active", AccountNumberType: "bank", ChannelIds: []string{"gh-momo"}},
+			{ID: "mtn", Name: "MTN", Country: "GH", Status: "active", AccountNumberType: "phone", ChannelIds: []string{"gh-momo"}},
+		},
+	}
+
+	route, err := routes.resolve(&models.Employee{Country: "GH", AccountType: models.PayoutMomo, BankName: "MTN"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "gh-momo", route.Channel.ID)
+	assert.Equal(t, "mtn", route.Network.ID)
+}
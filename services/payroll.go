@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"yc-backend/common"
+	"yc-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultPayrollConcurrency = 5
+	payrollPaymentTimeout     = 30 * time.Second
+)
+
+var ErrNoEmployees = errors.New("no employees to pay")
+
+// CreatePayrollRun records a new payroll run covering every active employee of
+// the user, once the balance preflight shows the payroll can be funded. A work
+// item reserving the disbursement id and sequenceId is stored for each
+// employee before the run, so a run is never resumed without them.
+func (s *DisbursementService) CreatePayrollRun(ctx context.Context, user *models.User) (*models.PayrollRun, []models.Employee, error) {
+	return s.createPayrollRun(ctx, user, primitive.NewObjectID())
+}
+
+// createPayrollRun is CreatePayrollRun under a reserved run id. Work items an
+// interrupted attempt stored under the id are kept, with their reservations.
+func (s *DisbursementService) createPayrollRun(ctx context.Context, user *models.User, runID primitive.ObjectID) (*models.PayrollRun, []models.Employee, error) {
+	employees, err := s.payrollEmployees(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	business, err := s.SenderBusiness(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	routes, err := s.loadRoutes()
+	if err != nil {
+		return nil, nil, err
+	}
+	payments := []models.PaymentRequest{}
+	for i := range employees {
+		disbursement, err := s.prepare(DisbursementRequest{User: user, Employee: &employees[i], routes: routes, business: business})
+		// employees that cannot be paid are recorded as failures of the run
+		if IsUnpayable(err) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		payments = append(payments, *disbursement.PaymentRequest)
+	}
+	if _, err := s.Preflight(ctx, payments); err != nil {
+		return nil, nil, err
+	}
+
+	timeNow := time.Now()
+	run := models.PayrollRun{
+		ID:            runID,
+		UserID:        user.ID,
+		Status:        models.PayrollRunRunning,
+		EmployeeCount: len(employees),
+		CreatedAt:     &timeNow,
+		UpdatedAt:     &timeNow,
+	}
+
+	for _, employee := range employees {
+		if _, err := s.repos.WorkItem.Create(ctx, models.PayrollWorkItem{
+			RunID:          run.ID,
+			EmployeeID:     employee.ID,
+			DisbursementID: primitive.NewObjectID(),
+			SequenceID:     uuid.New().String(),
+			Status:         models.WorkItemPending,
+			CreatedAt:      &timeNow,
+			UpdatedAt:      &timeNow,
+		}); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return nil, nil, err
+		}
+	}
+	if _, err := s.repos.PayrollRun.Create(ctx, run); err != nil {
+		return nil, nil, err
+	}
+	return &run, employees, nil
+}
+
+// payrollEmployees returns the active employees of the user.
+func (s *DisbursementService) payrollEmployees(ctx context.Context, user *models.User) ([]models.Employee, error) {
+	employees, err := s.repos.Employee.FindMany(ctx, bson.D{
+		{Key: "user_id", Value: user.ID},
+		{Key: "status", Value: bson.D{{Key: "$ne", Value: models.EmployeeInactive}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(employees) == 0 {
+		return nil, ErrNoEmployees
+	}
+	return employees, nil
+}
+
+// IsUnpayable reports whether err means the employee cannot be paid at all, as
+// opposed to a failure to reach Yellow Card or the database.
+func IsUnpayable(err error) bool {
+	for _, target := range []error{ErrNothingToPay, ErrNoChannel, ErrNoNetwork, ErrNoRate, ErrAccountNotVerified, ErrInvalidAccountNumber, ErrBusinessProfileIncomplete, ErrBelowChannelMinimum, ErrSplitQuote} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExecutePayrollRun submits a payment for each employee of the run whose work
+// item is not settled yet, keeping at most cfg.Payroll.Concurrency requests to
+// Yellow Card in flight. The run stays running while any work item is left
+// unsettled, so it is resumed on the next start.
+func (s *DisbursementService) ExecutePayrollRun(ctx context.Context, run *models.PayrollRun, user *models.User, employees []models.Employee) {
+	concurrency := s.cfg.Payroll.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultPayrollConcurrency
+	}
+
+	items, err := s.repos.WorkItem.FindMany(ctx, bson.D{{Key: "run_id", Value: run.ID}})
+	if err != nil {
+		s.logger.Errorf("payroll run [%s] could not load its work items: %v", run.ID.Hex(), err)
+		return
+	}
+	itemsByEmployee := lo.KeyBy(items, func(item models.PayrollWorkItem) primitive.ObjectID {
+		return item.EmployeeID
+	})
+
+	routes, err := s.loadRoutes()
+	if err != nil {
+		// each payment fetches the routes itself instead
+		s.logger.Errorf("payroll run [%s] could not load payment routes: %v", run.ID.Hex(), err)
+	}
+	business, err := s.SenderBusiness(ctx, user.ID)
+	if err != nil {
+		// each payment fails with the reason instead
+		s.logger.Errorf("payroll run [%s] has no sender business: %v", run.ID.Hex(), err)
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, concurrency)
+	)
+
+	for i := range employees {
+		employee := employees[i]
+		item, ok := itemsByEmployee[employee.ID]
+		if !ok || item.Status == models.WorkItemConfirmed || item.Status == models.WorkItemFailed {
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			paymentCtx, cancel := context.WithTimeout(ctx, payrollPaymentTimeout)
+			defer cancel()
+
+			err := s.payWorkItem(paymentCtx, DisbursementRequest{
+				User:         user,
+				Employee:     &employee,
+				PayrollRunID: run.ID,
+				preflighted:  true,
+				routes:       routes,
+				business:     business,
+			}, item)
+			if err != nil {
+				s.logger.Errorf("payroll run [%s] failed to pay employee [%s]: %v", run.ID.Hex(), employee.ID.Hex(), err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	updateCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := s.finishPayrollRun(updateCtx, run); err != nil {
+		s.logger.Errorf("could not update payroll run [%s]: %v", run.ID.Hex(), err)
+	}
+}
+
+// StartPayrollRun creates a payroll run and executes it in the background as
+// one of the application's jobs, so a shutdown stops it between employees.
+func (s *DisbursementService) StartPayrollRun(ctx context.Context, user *models.User, jobs common.JobRunner) (*models.PayrollRun, error) {
+	run, employees, err := s.CreatePayrollRun(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	jobs.Go(func(jobCtx context.Context) {
+		s.ExecutePayrollRun(jobCtx, run, user, employees)
+	})
+	return run, nil
+}
+
+// PayrollRunSummary returns the run together with the status counts of its disbursements.
+func (s *DisbursementService) PayrollRunSummary(ctx context.Context, userID, runID primitive.ObjectID) (*models.PayrollRunSummary, error) {
+	run, err := s.repos.PayrollRun.FindOne(ctx, bson.D{
+		{Key: "_id", Value: runID},
+		{Key: "user_id", Value: userID},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	disbursements, err := s.repos.Disbursement.FindMany(ctx, bson.D{{Key: "payroll_run_id", Value: runID}})
+	if err != nil {
+		return nil, err
+	}
+
+	summary := models.PayrollRunSummary{
+		Run:       *run,
+		Submitted: len(disbursements),
+		Failed:    len(run.Failures),
+	}
+	for _, disbursement := range disbursements {
+		switch disbursement.Status {
+		case models.DisbursementCompleted:
+			summary.Completed++
+		case models.DisbursementFailed, models.DisbursementDenied, models.DisbursementExpired, models.DisbursementRejected:
+			summary.Failed++
+		case models.DisbursementAwaitingApproval:
+			summary.AwaitingApproval++
+		default:
+			summary.Processing++
+		}
+	}
+	return &summary, nil
+}
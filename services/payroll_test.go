@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"yc-backend/models"
+
+	"github.com/gookit/goutil/testutil/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestPayrollRunSummaryCountsDisbursementsByStatus(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("mixed statuses", func(mt *mtest.T) {
+		svc := mockService(mt)
+		userID, runID := primitive.NewObjectID(), primitive.NewObjectID()
+		statuses := []models.DisbursementStatus{
+			models.DisbursementCompleted,
+			models.DisbursementCompleted,
+			models.DisbursementFailed,
+			models.DisbursementDenied,
+			models.DisbursementExpired,
+			models.DisbursementRejected,
+			models.DisbursementAwaitingApproval,
+			models.DisbursementCreated,
+			models.DisbursementPending,
+			models.DisbursementProcessing,
+		}
+		disbursements := []bson.D{}
+		for _, status := range statuses {
+			disbursements = append(disbursements, bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "payroll_run_id", Value: runID},
+				{Key: "status", Value: status},
+			})
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "yc.payroll_runs", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: runID},
+				{Key: "user_id", Value: userID},
+				{Key: "status", Value: models.PayrollRunSubmitted},
+				{Key: "employee_count", Value: 11},
+				// an employee whose payment could not even be created
+				{Key: "failures", Value: bson.A{bson.D{{Key: "employee_id", Value: primitive.NewObjectID()}, {Key: "error", Value: "unverified account"}}}},
+			}),
+			mtest.CreateCursorResponse(0, "yc.disbursements", mtest.FirstBatch, disbursements...),
+		)
+
+		summary, err := svc.PayrollRunSummary(context.Background(), userID, runID)
+
+		assert.NoErr(t, err)
+		assert.Eq(t, runID, summary.Run.ID)
+		assert.Eq(t, 10, summary.Submitted)
+		assert.Eq(t, 2, summary.Completed)
+		assert.Eq(t, 5, summary.Failed)
+		assert.Eq(t, 1, summary.AwaitingApproval)
+		assert.Eq(t, 3, summary.Processing)
+		// every employee of the run is accounted for exactly once
+		assert.Eq(t, summary.Run.EmployeeCount,
+			summary.Completed+summary.Failed+summary.AwaitingApproval+summary.Processing)
+
+		events := mt.GetAllStartedEvents()
+		assert.Eq(t, userID, events[0].Command.Lookup("filter", "user_id").ObjectID())
+		assert.Eq(t, runID, events[1].Command.Lookup("filter", "payroll_run_id").ObjectID())
+	})
+
+	mt.Run("another business's run", func(mt *mtest.T) {
+		svc := mockService(mt)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "yc.payroll_runs", mtest.FirstBatch))
+
+		summary, err := svc.PayrollRunSummary(context.Background(), primitive.NewObjectID(), primitive.NewObjectID())
+
+		assert.ErrIs(t, err, mongo.ErrNoDocuments)
+		assert.Nil(t, summary)
+		assert.Len(t, mt.GetAllStartedEvents(), 1)
+	})
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"yc-backend/models"
+
+	"github.com/go-pdf/fpdf"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrPayslipUnavailable = errors.New("payslips are only available for completed disbursements")
+
+// PayslipData is everything printed on a payslip.
+type PayslipData struct {
+	Employer     *models.User
+	Employee     *models.Employee
+	Disbursement *models.Disbursement
+}
+
+// Payslip renders the payslip of a completed disbursement made by the user and
+// returns the PDF together with a file name for it.
+func (s *DisbursementService) Payslip(ctx context.Context, userID, disbursementID primitive.ObjectID) ([]byte, string, error) {
+	disbursement, err := s.FindDisbursement(ctx, userID, disbursementID)
+	if err != nil {
+		return nil, "", err
+	}
+	if disbursement.Status != models.DisbursementCompleted {
+		return nil, "", ErrPayslipUnavailable
+	}
+
+	employer, err := s.repos.User.FindOneById(ctx, disbursement.SenderID)
+	if err != nil {
+		return nil, "", err
+	}
+	employee, err := s.repos.Employee.FindOneById(ctx, disbursement.ReceiverID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pdf, err := RenderPayslip(PayslipData{
+		Employer:     employer,
+		Employee:     employee,
+		Disbursement: disbursement,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	fileName := fmt.Sprintf("payslip-%s-%s.pdf",
+		strings.ToLower(employee.LastName), payPeriod(disbursement).Format("2006-01"))
+	return pdf, fileName, nil
+}
+
+// RenderPayslip lays out the payslip as an A4 PDF using only the core fonts,
+// so no font files are needed at runtime.
+func RenderPayslip(data PayslipData) ([]byte, error) {
+	disbursement, employer, employee := data.Disbursement, data.Employer, data.Employee
+
+	breakdown := models.PayBreakdown{Gross: disbursement.SalaryAmount, Net: disbursement.SalaryAmount}
+	if disbursement.Breakdown != nil {
+		breakdown = *disbursement.Breakdown
+	}
+	currency := disbursement.Payment.Currency
+	if currency == "" {
+		currency = disbursement.Currency
+	}
+	if currency == "" {
+		currency = "NGN"
+	}
+	money := func(amount float64) string {
+		return fmt.Sprintf("%s %s", currency, formatAmount(amount))
+	}
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Payslip", false)
+	pdf.SetMargins(15, 15, 15)
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 10, "Payslip", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(0, 6, "Pay period: "+payPeriod(disbursement).Format("January 2006"), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	section := func(title string) {
+		pdf.SetFont("Helvetica", "B", 11)
+		pdf.SetFillColor(235, 235, 235)
+		pdf.CellFormat(0, 7, title, "", 1, "L", true, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+	}
+	row := func(label, value string) {
+		pdf.CellFormat(60, 6, label, "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 6, value, "", 1, "L", false, 0, "")
+	}
+	amountRow := func(label string, amount float64) {
+		pdf.CellFormat(120, 6, label, "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 6, money(amount), "", 1, "R", false, 0, "")
+	}
+
+	section("Employer")
+	row("Name", strings.TrimSpace(employer.FirstName+" "+employer.LastName))
+	row("Address", employer.Address)
+	row("Email", employer.Email)
+	pdf.Ln(3)
+
+	section("Employee")
+	row("Name", strings.TrimSpace(strings.Join([]string{employee.FirstName, employee.MiddleName, employee.LastName}, " ")))
+	row("Email", employee.Email)
+	row("Bank", employee.BankName)
+	row("Account name", employee.AccountName)
+	pdf.Ln(3)
+
+	section("Earnings")
+	for _, earning := range breakdown.Earnings {
+		amountRow(earning.Name, earning.Amount)
+	}
+	pdf.SetFont("Helvetica", "B", 10)
+	amountRow("Gross pay", breakdown.Gross)
+	pdf.Ln(3)
+
+	section("Deductions")
+	for _, deduction := range breakdown.Deductions {
+		amountRow(deduction.Name, deduction.Amount)
+	}
+	pdf.SetFont("Helvetica", "B", 10)
+	amountRow("Total deductions", breakdown.TotalDeductions)
+	if breakdown.PensionEmployer > 0 {
+		pdf.SetFont("Helvetica", "I", 9)
+		amountRow("Employer pension contribution (not deducted)", breakdown.PensionEmployer)
+	}
+	pdf.Ln(3)
+
+	pdf.SetFont("Helvetica", "B", 12)
+	amountRow("Net pay", disbursement.SalaryAmount)
+	pdf.Ln(3)
+
+	section("Payment")
+	row("Yellow Card payment id", disbursement.Payment.ID)
+	row("Sequence id", disbursement.Payment.SequenceID)
+	if disbursement.Payment.Rate != 0 {
+		row("Rate", formatAmount(disbursement.Payment.Rate))
+	}
+	if disbursement.Payment.Amount != 0 {
+		row("Amount (USD)", formatAmount(disbursement.Payment.Amount))
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func payPeriod(disbursement *models.Disbursement) time.Time {
+	if disbursement.CreatedAt != nil {
+		return *disbursement.CreatedAt
+	}
+	return disbursement.ID.Timestamp()
+}
+
+// formatAmount renders an amount with thousands separators and two decimals.
+func formatAmount(amount float64) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	whole := fmt.Sprintf("%.2f", amount)
+	integer, fraction := whole[:len(whole)-3], whole[len(whole)-3:]
+
+	var grouped strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	return sign + grouped.String() + fraction
+}
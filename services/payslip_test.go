@@ -0,0 +1,37 @@
+package services
+
+import (
+	"bytes"
+	"testing"
+	"time"
+	"yc-backend/models"
+
+	"github.com/gookit/goutil/testutil/assert"
+)
+
+func TestRenderPayslip(t *testing.T) {
+	createdAt := time.Date(2024, time.June, 28, 9, 0, 0, 0, time.UTC)
+	breakdown := ComputePay(&models.Employee{PayComponents: &models.PayComponents{Basic: 300000, Housing: 100000}})
+
+	pdf, err := RenderPayslip(PayslipData{
+		Employer: &models.User{FirstName: "Ada", LastName: "Obi", Email: "ada@example.com"},
+		Employee: &models.Employee{FirstName: "Tunde", LastName: "Bello", BankName: "GTBank"},
+		Disbursement: &models.Disbursement{
+			CreatedAt:    &createdAt,
+			SalaryAmount: breakdown.Net,
+			Breakdown:    &breakdown,
+			Status:       models.DisbursementCompleted,
+			Payment:      models.Payment{ID: "pay-1", Currency: "NGN", Rate: 1480.5},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF")))
+}
+
+func TestFormatAmount(t *testing.T) {
+	assert.Equal(t, "0.00", formatAmount(0))
+	assert.Equal(t, "999.50", formatAmount(999.5))
+	assert.Equal(t, "1,234,567.89", formatAmount(1234567.891))
+	assert.Equal(t, "-1,000.00", formatAmount(-1000))
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+	"yc-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrNotAQuote    = errors.New("disbursement is not awaiting quote acceptance")
+	ErrQuoteExpired = errors.New("disbursement quote has expired")
+)
+
+// QuoteExpired reports whether the quote returned by Yellow Card can no longer be accepted.
+func QuoteExpired(payment models.Payment, now time.Time) bool {
+	if payment.ExpiresAt == "" {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, payment.ExpiresAt)
+	if err != nil {
+		return false
+	}
+	return !now.Before(expiresAt)
+}
+
+// AcceptQuote accepts a quoted payment so Yellow Card starts processing it.
+// Quotes past Payment.ExpiresAt are denied and marked expired instead.
+func (s *DisbursementService) AcceptQuote(ctx context.Context, userID, disbursementID primitive.ObjectID) (*models.Disbursement, error) {
+	disbursement, err := s.findQuote(ctx, userID, disbursementID)
+	if err != nil {
+		return nil, err
+	}
+
+	if QuoteExpired(disbursement.Payment, time.Now()) {
+		if _, err := s.client.DenyPayment(disbursement.Payment.ID); err != nil {
+			s.logger.Warningf("could not deny expired payment [%s]: %v", disbursement.Payment.ID, err)
+		}
+		if err := s.updateQuote(ctx, disbursement, models.DisbursementExpired, nil); err != nil {
+			return nil, err
+		}
+		return nil, ErrQuoteExpired
+	}
+
+	payment, err := s.client.AcceptPayment(disbursement.Payment.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.updateQuote(ctx, disbursement, models.DisbursementProcessing, &payment); err != nil {
+		return nil, err
+	}
+	return disbursement, nil
+}
+
+// DenyQuote rejects a quoted payment; no money moves.
+func (s *DisbursementService) DenyQuote(ctx context.Context, userID, disbursementID primitive.ObjectID) (*models.Disbursement, error) {
+	disbursement, err := s.findQuote(ctx, userID, disbursementID)
+	if err != nil {
+		return nil, err
+	}
+
+	payment, err := s.client.DenyPayment(disbursement.Payment.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.updateQuote(ctx, disbursement, models.DisbursementDenied, &payment); err != nil {
+		return nil, err
+	}
+	return disbursement, nil
+}
+
+func (s *DisbursementService) findQuote(ctx context.Context, userID, disbursementID primitive.ObjectID) (*models.Disbursement, error) {
+	disbursement, err := s.FindDisbursement(ctx, userID, disbursementID)
+	if err != nil {
+		return nil, err
+	}
+	if disbursement.Status != models.DisbursementQuoted {
+		return nil, ErrNotAQuote
+	}
+	return disbursement, nil
+}
+
+func (s *DisbursementService) updateQuote(ctx context.Context, disbursement *models.Disbursement, status models.DisbursementStatus, payment *models.Payment) error {
+	if payment != nil && payment.ID != "" {
+		if err := s.repos.Disbursement.UpdateOneById(ctx, disbursement.ID, models.Disbursement{Payment: *payment}); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.Transition(ctx, disbursement, status, models.StatusSourceAPI, "")
+	if errors.Is(err, ErrStatusConflict) {
+		// a webhook got there first; report whatever is stored now
+		current, err := s.repos.Disbursement.FindOneById(ctx, disbursement.ID)
+		if err != nil {
+			return err
+		}
+		*disbursement = *current
+		return nil
+	}
+	return err
+}
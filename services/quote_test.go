@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"yc-backend/models"
+	"yc-backend/pkg"
+
+	"github.com/gookit/goutil/testutil/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestQuoteExpired(t *testing.T) {
+	expiresAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		expiresAt string
+		now       time.Time
+		expired   bool
+	}{
+		{name: "no expiry", expiresAt: "", now: expiresAt.Add(time.Hour), expired: false},
+		{name: "unparsable expiry", expiresAt: "soon", now: expiresAt.Add(time.Hour), expired: false},
+		{name: "a second before", expiresAt: expiresAt.Format(time.RFC3339), now: expiresAt.Add(-time.Second), expired: false},
+		{name: "a nanosecond before", expiresAt: expiresAt.Format(time.RFC3339), now: expiresAt.Add(-time.Nanosecond), expired: false},
+		{name: "at expiry", expiresAt: expiresAt.Format(time.RFC3339), now: expiresAt, expired: true},
+		{name: "after expiry", expiresAt: expiresAt.Format(time.RFC3339), now: expiresAt.Add(time.Second), expired: true},
+		{name: "offset expiry", expiresAt: "2024-03-01T13:00:00+01:00", now: expiresAt, expired: true},
+		{name: "offset expiry ahead", expiresAt: "2024-03-01T13:00:01+01:00", now: expiresAt, expired: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Eq(t, tt.expired, QuoteExpired(models.Payment{ExpiresAt: tt.expiresAt}, tt.now))
+		})
+	}
+}
+
+// quoteService answers payment actions from a mock Yellow Card, counting the
+// calls made to each action.
+func quoteService(t *testing.T, mt *mtest.T) (*DisbursementService, map[string]int) {
+	calls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		calls[action]++
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"id": "payment-1", "status": "processing"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	svc := mockService(mt)
+	svc.client = pkg.NewYellowClient(server.URL, "key", "secret")
+	return svc, calls
+}
+
+func quotedDisbursementDoc(id primitive.ObjectID, status models.DisbursementStatus, expiresAt string) bson.D {
+	return bson.D{
+		{Key: "_id", Value: id},
+		{Key: "status", Value: status},
+		{Key: "payment", Value: bson.D{{Key: "id", Value: "payment-1"}, {Key: "expiresat", Value: expiresAt}}},
+	}
+}
+
+func TestAcceptQuoteRefusesExpiredQuotes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name      string
+		expiresAt time.Duration
+	}{
+		{name: "expired an hour ago", expiresAt: -time.Hour},
+		{name: "expired a second ago", expiresAt: -time.Second},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			svc, calls := quoteService(t, mt)
+			id := primitive.NewObjectID()
+			expiresAt := time.Now().Add(tt.expiresAt).UTC().Format(time.RFC3339)
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "yc.disbursements", mtest.FirstBatch,
+					quotedDisbursementDoc(id, models.DisbursementQuoted, expiresAt)),
+				mtest.CreateSuccessResponse(bson.E{Key: "value", Value: quotedDisbursementDoc(id, models.DisbursementExpired, expiresAt)}),
+			)
+
+			disbursement, err := svc.AcceptQuote(context.Background(), primitive.NewObjectID(), id)
+
+			assert.ErrIs(t, err, ErrQuoteExpired)
+			assert.Nil(t, disbursement)
+			assert.Eq(t, 0, calls["accept"])
+			assert.Eq(t, 1, calls["deny"])
+			updates := findAndModifyUpdates(mt)
+			assert.Len(t, updates, 1)
+			assert.Eq(t, string(models.DisbursementExpired), updates[0].Lookup("update", "$set", "status").StringValue())
+		})
+	}
+}
+
+func TestAcceptQuoteAcceptsQuotesBeforeExpiry(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name      string
+		expiresAt string
+	}{
+		{name: "expires in an hour", expiresAt: time.Now().Add(time.Hour).UTC().Format(time.RFC3339)},
+		{name: "no expiry", expiresAt: ""},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			svc, calls := quoteService(t, mt)
+			id := primitive.NewObjectID()
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "yc.disbursements", mtest.FirstBatch,
+					quotedDisbursementDoc(id, models.DisbursementQuoted, tt.expiresAt)),
+				mtest.CreateSuccessResponse(bson.E{Key: "value", Value: quotedDisbursementDoc(id, models.DisbursementQuoted, tt.expiresAt)}),
+				mtest.CreateSuccessResponse(bson.E{Key: "value", Value: quotedDisbursementDoc(id, models.DisbursementProcessing, tt.expiresAt)}),
+			)
+
+			disbursement, err := svc.AcceptQuote(context.Background(), primitive.NewObjectID(), id)
+
+			assert.NoErr(t, err)
+			assert.Eq(t, models.DisbursementProcessing, disbursement.Status)
+			assert.Eq(t, 1, calls["accept"])
+			assert.Eq(t, 0, calls["deny"])
+		})
+	}
+}
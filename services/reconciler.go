@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"time"
+	"yc-backend/common"
+	"yc-backend/internals"
+	"yc-backend/models"
+	"yc-backend/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	defaultReconcileInterval   = 5 * time.Minute
+	defaultReconcileStaleAfter = 15 * time.Minute
+	reconcileLookupTimeout     = 15 * time.Second
+)
+
+// Reconciler periodically looks up disbursements that have not reached a
+// terminal status within the configured threshold and applies the state Yellow
+// Card reports for them, covering webhooks that were never delivered. Created
+// disbursements whose submission was never confirmed are resumed. It also
+// submits the automatic retries scheduled for failed disbursements.
+type Reconciler struct {
+	svc        *DisbursementService
+	repos      *repository.Repositories
+	logger     internals.Logger
+	interval   time.Duration
+	staleAfter time.Duration
+}
+
+// NewReconciler constructor
+func NewReconciler(cfg *common.Config, repos *repository.Repositories, logger internals.Logger) *Reconciler {
+	interval := time.Duration(cfg.Reconciliation.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultReconcileInterval
+	}
+	staleAfter := time.Duration(cfg.Reconciliation.StaleAfter) * time.Second
+	if staleAfter <= 0 {
+		staleAfter = defaultReconcileStaleAfter
+	}
+	return &Reconciler{
+		svc:        NewDisbursementService(cfg, repos, logger),
+		repos:      repos,
+		logger:     logger,
+		interval:   interval,
+		staleAfter: staleAfter,
+	}
+}
+
+// Run reconciles on every tick until ctx is cancelled.
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	r.logger.Infof("disbursement reconciler started, checking every %v", r.interval)
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Infof("disbursement reconciler stopped")
+			return
+		case <-ticker.C:
+			r.reconcile(ctx)
+			r.retryDue(ctx)
+		}
+	}
+}
+
+func (r *Reconciler) reconcile(ctx context.Context) {
+	cutoff := time.Now().Add(-r.staleAfter)
+	disbursements, err := r.repos.Disbursement.FindMany(ctx, bson.D{
+		{Key: "status", Value: bson.D{{Key: "$in", Value: []models.DisbursementStatus{
+			models.DisbursementCreated,
+			models.DisbursementQuoted,
+			models.DisbursementPending,
+			models.DisbursementProcessing,
+		}}}},
+		// disbursements that were never updated are stale from when they were created
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "updatedAt", Value: bson.D{{Key: "$lte", Value: cutoff}}}},
+			bson.D{
+				{Key: "updatedAt", Value: nil},
+				{Key: "createdAt", Value: bson.D{{Key: "$lte", Value: cutoff}}},
+			},
+		}},
+	})
+	if err != nil {
+		r.logger.Errorf("reconciler could not load stale disbursements: %v", err)
+		return
+	}
+
+	for i := range disbursements {
+		if ctx.Err() != nil {
+			return
+		}
+		r.reconcileOne(ctx, &disbursements[i])
+	}
+}
+
+func (r *Reconciler) reconcileOne(ctx context.Context, disbursement *models.Disbursement) {
+	if disbursement.Status == models.DisbursementCreated {
+		// a submission whose outcome was never confirmed
+		if _, err := r.svc.resume(ctx, disbursement); err != nil {
+			r.logger.Errorf("reconciler could not resume disbursement [%s]: %v", disbursement.ID.Hex(), err)
+		}
+		return
+	}
+	if len(disbursement.SplitAmounts) > 0 {
+		// a split disbursement follows its parts, which are reconciled on their own
+		if err := r.svc.settleSplit(ctx, disbursement.ID, models.StatusSourcePoller); err != nil {
+			r.logger.Errorf("reconciler could not update split disbursement [%s]: %v", disbursement.ID.Hex(), err)
+		}
+		return
+	}
+	if disbursement.Payment.ID == "" {
+		return
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, reconcileLookupTimeout)
+	defer cancel()
+
+	payment, err := r.svc.client.GetPayment(lookupCtx, disbursement.Payment.ID)
+	if err != nil {
+		r.logger.Errorf("reconciler could not look up payment [%s]: %v", disbursement.Payment.ID, err)
+		return
+	}
+
+	status, ok := PaymentStatus(payment.Status)
+	if disbursement.Status == models.DisbursementQuoted && (!ok || status == models.DisbursementPending) {
+		// an unaccepted quote stays a quote until it expires
+		if !QuoteExpired(disbursement.Payment, time.Now()) {
+			return
+		}
+		status, ok = models.DisbursementExpired, true
+	}
+	if !ok {
+		return
+	}
+
+	updated, err := r.svc.ApplyStatusUpdate(lookupCtx, StatusUpdate{
+		SequenceID: disbursement.Payment.SequenceID,
+		Status:     status,
+		Source:     models.StatusSourcePoller,
+		Reason:     payment.ErrorCode,
+	})
+	if err != nil {
+		r.logger.Errorf("reconciler could not update disbursement [%s]: %v", disbursement.ID.Hex(), err)
+		return
+	}
+	if updated.Status != disbursement.Status {
+		r.logger.Noticef("reconciler corrected disbursement [%s] (payment %s) from %s to %s",
+			disbursement.ID.Hex(), disbursement.Payment.ID, disbursement.Status, updated.Status)
+	}
+}
+
+func (r *Reconciler) retryDue(ctx context.Context) {
+	disbursements, err := r.repos.Disbursement.FindMany(ctx, bson.D{
+		{Key: "status", Value: models.DisbursementFailed},
+		{Key: "next_retry_at", Value: bson.D{{Key: "$lte", Value: time.Now()}}},
+		{Key: "retried_by", Value: bson.D{{Key: "$exists", Value: false}}},
+	})
+	if err != nil {
+		r.logger.Errorf("reconciler could not load disbursements due for retry: %v", err)
+		return
+	}
+
+	for i := range disbursements {
+		if ctx.Err() != nil {
+			return
+		}
+		retryCtx, cancel := context.WithTimeout(ctx, payrollPaymentTimeout)
+		retry, err := r.svc.retry(retryCtx, &disbursements[i])
+		cancel()
+		if err != nil {
+			r.logger.Errorf("automatic retry of disbursement [%s] failed: %v", disbursements[i].ID.Hex(), err)
+			continue
+		}
+		r.logger.Noticef("automatically retried disbursement [%s] as [%s] (attempt %d)",
+			disbursements[i].ID.Hex(), retry.ID.Hex(), retry.Attempt)
+	}
+}
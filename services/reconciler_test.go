@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"yc-backend/internals"
+	"yc-backend/pkg"
+
+	"github.com/gookit/goutil/testutil/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestReconcileFallsBackToCreatedAt(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("disbursements never updated", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "yc.disbursements", mtest.FirstBatch))
+		svc := mockService(mt)
+		reconciler := &Reconciler{svc: svc, repos: svc.repos, logger: svc.logger, staleAfter: time.Minute}
+
+		reconciler.reconcile(context.Background())
+
+		filter := mt.GetStartedEvent().Command.Lookup("filter", "$or").Array()
+		values, err := filter.Values()
+		assert.NoError(t, err)
+		assert.Len(t, values, 2)
+		stale := values[1].Document()
+		assert.Equal(t, bson.TypeNull, stale.Lookup("updatedAt").Type)
+		assert.NotEmpty(t, stale.Lookup("createdAt", "$lte").Time())
+	})
+}
+
+func TestGetPaymentGivesUpWithContext(t *testing.T) {
+	svc, _ := newLookupService(t, http.StatusOK)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := svc.client.GetPayment(ctx, "payment")
+
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestFailedPaymentLookupsReuseTheConnection(t *testing.T) {
+	connections := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`{"code": "error"}`))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections++
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	svc := &DisbursementService{client: pkg.NewYellowClient(server.URL, "key", "secret"), logger: internals.GetLogger()}
+
+	for i := 0; i < 3; i++ {
+		_, err := svc.client.GetPayment(context.Background(), "payment")
+		assert.Err(t, err)
+	}
+
+	// failed responses are closed and the client keeps one transport, so lookups share a connection
+	assert.Eq(t, 1, connections)
+}
@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"yc-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrReplayUnfiltered = errors.New("choose the webhook events to replay by event id, sequenceId or time range")
+
+// webhookReplaySkipped is the outcome of a stored event replay leaves alone.
+const webhookReplaySkipped = "skipped"
+
+// WebhookReplayResult is what replaying one stored webhook event did, or would
+// do in a dry run, to its disbursement.
+type WebhookReplayResult struct {
+	EventID        string                    `json:"eventId,omitempty"`
+	Event          string                    `json:"event,omitempty"`
+	SequenceID     string                    `json:"sequenceId,omitempty"`
+	DisbursementID primitive.ObjectID        `json:"disbursementId,omitempty"`
+	From           models.DisbursementStatus `json:"from,omitempty"`
+	To             models.DisbursementStatus `json:"to,omitempty"`
+	Changed        bool                      `json:"changed"`
+	// Outcome is the webhook event status the replay records, or skipped for
+	// events that cannot be replayed.
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// WebhookReplay reports a replay of stored webhook events, oldest first.
+type WebhookReplay struct {
+	DryRun bool `json:"dryRun"`
+	// Force is set on rebuilds, which report one result per disbursement.
+	Force   bool                  `json:"force,omitempty"`
+	Events  int                   `json:"events"`
+	Changed int                   `json:"changed"`
+	Results []WebhookReplayResult `json:"results"`
+}
+
+// ReplayWebhooks runs the stored webhook events matching the filter through the
+// webhook handling again, in the order they were received. Events with an
+// invalid signature or an unreadable body are skipped. A dry run changes
+// nothing and reports the status changes the events would make, following each
+// disbursement from one event to the next.
+func (s *DisbursementService) ReplayWebhooks(ctx context.Context, filter WebhookEventFilter, dryRun bool) (*WebhookReplay, error) {
+	query := filter.query()
+	if len(query) == 0 {
+		return nil, ErrReplayUnfiltered
+	}
+	events, err := s.repos.WebhookEvent.FindMany(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return receivedAt(events[i]).Before(receivedAt(events[j]))
+	})
+
+	replay := &WebhookReplay{DryRun: dryRun, Events: len(events), Results: []WebhookReplayResult{}}
+	simulated := map[string]models.DisbursementStatus{}
+	for i := range events {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		event := &events[i]
+		result := WebhookReplayResult{EventID: event.EventID, Event: event.Event, SequenceID: event.SequenceID}
+
+		var payload WebhookPayload
+		if !event.SignatureValid {
+			result.Outcome, result.Error = webhookReplaySkipped, ErrInvalidSignature.Error()
+		} else if err := json.Unmarshal([]byte(event.Body), &payload); err != nil {
+			result.Outcome, result.Error = webhookReplaySkipped, err.Error()
+		} else if dryRun {
+			s.simulateWebhook(ctx, payload, simulated, &result)
+		} else {
+			s.replayWebhook(ctx, event, payload, &result)
+		}
+
+		if result.Changed {
+			replay.Changed++
+		}
+		replay.Results = append(replay.Results, result)
+	}
+	return replay, nil
+}
+
+// simulateWebhook works out the status change the event would apply, starting
+// from the status earlier events of the replay left the disbursement in.
+func (s *DisbursementService) simulateWebhook(ctx context.Context, payload WebhookPayload, simulated map[string]models.DisbursementStatus, result *WebhookReplayResult) {
+	status, ok := WebhookStatus(payload.Event)
+	if !ok {
+		result.Outcome = models.WebhookEventIgnored
+		return
+	}
+	disbursement, err := s.repos.Disbursement.FindOne(ctx, bson.D{{Key: "payment.sequenceid", Value: payload.SequenceID}})
+	if err != nil {
+		result.Outcome, result.Error = models.WebhookEventFailed, err.Error()
+		return
+	}
+
+	from, ok := simulated[payload.SequenceID]
+	if !ok {
+		from = disbursement.Status
+	}
+	result.DisbursementID = disbursement.ID
+	result.Outcome = models.WebhookEventProcessed
+	result.From, result.To = from, from
+	if reason := transitionNote(from, status); reason != "" {
+		result.Error = reason
+		return
+	}
+	if from != status {
+		result.To, result.Changed = status, true
+		simulated[payload.SequenceID] = status
+	}
+}
+
+// replayWebhook applies the event again and records the replay on it.
+func (s *DisbursementService) replayWebhook(ctx context.Context, event *models.WebhookEvent, payload WebhookPayload, result *WebhookReplayResult) {
+	before, _ := s.repos.Disbursement.FindOne(ctx, bson.D{{Key: "payment.sequenceid", Value: payload.SequenceID}})
+	if status, ok := WebhookStatus(payload.Event); ok && before != nil {
+		result.Error = transitionNote(before.Status, status)
+	}
+
+	disbursement, outcome, err := s.processWebhook(ctx, payload)
+	result.Outcome = outcome
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if before != nil {
+		result.DisbursementID, result.From, result.To = before.ID, before.Status, before.Status
+	}
+	if disbursement != nil {
+		result.DisbursementID, result.To = disbursement.ID, disbursement.Status
+		result.Changed = before != nil && disbursement.Status != before.Status
+	}
+	s.recordReplay(ctx, event, outcome, err)
+}
+
+// recordReplay records the outcome of replaying the event and counts the replay.
+func (s *DisbursementService) recordReplay(ctx context.Context, event *models.WebhookEvent, status string, err error) {
+	reason := ""
+	if err != nil {
+		reason = err.Error()
+	}
+	timeNow := time.Now()
+	if _, uerr := s.repos.WebhookEvent.FindOneAndUpdate(context.WithoutCancel(ctx),
+		bson.D{{Key: "_id", Value: event.ID}},
+		bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "replays", Value: 1}}},
+			{Key: "$set", Value: bson.D{
+				{Key: "status", Value: status},
+				{Key: "error", Value: reason},
+				{Key: "processed_at", Value: timeNow},
+				{Key: "last_replayed_at", Value: timeNow},
+			}},
+		}); uerr != nil {
+		s.logger.Errorf("could not record replay of webhook event [%s]: %v", event.EventID, uerr)
+	}
+}
+
+// RebuildWebhookStatuses is the forced replay, for disbursements a bug left in
+// the wrong status. The status of every disbursement with an event matching the
+// filter is worked out again from all of its stored webhook events, starting
+// from the last status the API gave it, and stored even when the state machine
+// would not allow the move, such as out of a terminal status. The rebuild is
+// recorded in the status history and the spending counters follow it; no
+// retries are scheduled. A dry run changes nothing and reports the rebuilt
+// statuses.
+func (s *DisbursementService) RebuildWebhookStatuses(ctx context.Context, filter WebhookEventFilter, dryRun bool) (*WebhookReplay, error) {
+	query := filter.query()
+	if len(query) == 0 {
+		return nil, ErrReplayUnfiltered
+	}
+	events, err := s.repos.WebhookEvent.FindMany(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return receivedAt(events[i]).Before(receivedAt(events[j]))
+	})
+
+	replay := &WebhookReplay{DryRun: dryRun, Force: true, Events: len(events), Results: []WebhookReplayResult{}}
+	rebuilt := map[string]bool{}
+	for _, event := range events {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if event.SequenceID == "" || rebuilt[event.SequenceID] {
+			continue
+		}
+		rebuilt[event.SequenceID] = true
+
+		result := s.rebuildStatus(ctx, event.SequenceID, dryRun)
+		if result.Changed {
+			replay.Changed++
+		}
+		replay.Results = append(replay.Results, result)
+	}
+	return replay, nil
+}
+
+// rebuildStatus works out the status of the disbursement with the sequenceId
+// from its stored webhook events and, unless this is a dry run, stores it.
+func (s *DisbursementService) rebuildStatus(ctx context.Context, sequenceID string, dryRun bool) WebhookReplayResult {
+	result := WebhookReplayResult{SequenceID: sequenceID}
+	disbursement, err := s.repos.Disbursement.FindOne(ctx, bson.D{{Key: "payment.sequenceid", Value: sequenceID}})
+	if err != nil {
+		result.Outcome, result.Error = models.WebhookEventFailed, err.Error()
+		return result
+	}
+	result.DisbursementID = disbursement.ID
+	result.From, result.To = disbursement.Status, disbursement.Status
+
+	history, err := s.repos.WebhookEvent.FindMany(ctx, bson.D{{Key: "sequence_id", Value: sequenceID}})
+	if err != nil {
+		result.Outcome, result.Error = models.WebhookEventFailed, err.Error()
+		return result
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return receivedAt(history[i]).Before(receivedAt(history[j]))
+	})
+	status, last := foldWebhookStatuses(submittedStatus(disbursement), history)
+	if last == nil {
+		result.Outcome, result.Error = webhookReplaySkipped, "no stored status events"
+		return result
+	}
+	result.EventID, result.Event = last.EventID, last.Event
+	result.Outcome = models.WebhookEventProcessed
+	if status == disbursement.Status {
+		return result
+	}
+	if !dryRun {
+		if err := s.forceStatus(ctx, disbursement, status, last.EventID); err != nil {
+			result.Outcome, result.Error = models.WebhookEventFailed, err.Error()
+			return result
+		}
+	}
+	result.To, result.Changed = status, true
+	return result
+}
+
+// forceStatus stores the rebuilt status whatever the state machine allows,
+// provided the stored status is still the one the rebuild started from.
+func (s *DisbursementService) forceStatus(ctx context.Context, d *models.Disbursement, to models.DisbursementStatus, eventID string) error {
+	timeNow := time.Now()
+	updated, err := s.repos.Disbursement.FindOneAndUpdate(ctx,
+		bson.D{
+			{Key: "_id", Value: d.ID},
+			{Key: "status", Value: d.Status},
+		},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "status", Value: to},
+				{Key: "updatedAt", Value: timeNow},
+			}},
+			{Key: "$push", Value: bson.D{{Key: "status_history", Value: models.StatusChange{
+				Status:    to,
+				Source:    models.StatusSourceReplay,
+				Timestamp: timeNow,
+				EventID:   eventID,
+			}}}},
+		})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrStatusConflict
+	}
+	if err != nil {
+		return err
+	}
+	s.logger.Warningf("disbursement [%s] rebuilt from %s to %s", d.ID.Hex(), d.Status, to)
+
+	switch from := d.Status; {
+	case countsAgainstLimits(from) && !countsAgainstLimits(to):
+		s.releaseLimits(ctx, updated)
+	case !countsAgainstLimits(from) && countsAgainstLimits(to) && updated.ParentID.IsZero():
+		// the money did leave, so it is counted even over the limits
+		if err := s.reserveLimits(ctx, updated, true); err != nil {
+			s.logger.Errorf("could not count rebuilt disbursement [%s] against its limits: %v", d.ID.Hex(), err)
+		}
+	}
+	if !updated.ParentID.IsZero() {
+		if err := s.settleSplit(ctx, updated.ParentID, models.StatusSourceReplay); err != nil {
+			s.logger.Errorf("could not update split disbursement [%s]: %v", updated.ParentID.Hex(), err)
+		}
+	}
+	*d = *updated
+	return nil
+}
+
+// submittedStatus is the last status the API gave the disbursement, which the
+// payment's webhook events are applied to.
+func submittedStatus(d *models.Disbursement) models.DisbursementStatus {
+	for i := len(d.StatusHistory) - 1; i >= 0; i-- {
+		if d.StatusHistory[i].Source == models.StatusSourceAPI {
+			return d.StatusHistory[i].Status
+		}
+	}
+	return models.DisbursementCreated
+}
+
+// foldWebhookStatuses applies the signed status events, oldest first, to the
+// status under the state machine, skipping the moves it does not allow. It
+// returns the resulting status and the last event that set or confirmed it, or
+// nil when no event did.
+func foldWebhookStatuses(status models.DisbursementStatus, events []models.WebhookEvent) (models.DisbursementStatus, *models.WebhookEvent) {
+	var last *models.WebhookEvent
+	for i := range events {
+		next, ok := WebhookStatus(events[i].Event)
+		if !events[i].SignatureValid || !ok {
+			continue
+		}
+		if next == status || status.CanTransitionTo(next) {
+			status, last = next, &events[i]
+		}
+	}
+	return status, last
+}
+
+// transitionNote explains why moving a disbursement from one status to another
+// is ignored, or is empty when the move is allowed or changes nothing.
+func transitionNote(from, to models.DisbursementStatus) string {
+	if from == to || from.CanTransitionTo(to) {
+		return ""
+	}
+	return fmt.Sprintf("%v: %s -> %s", ErrIllegalTransition, from, to)
+}
+
+func receivedAt(event models.WebhookEvent) time.Time {
+	if event.ReceivedAt == nil {
+		return time.Time{}
+	}
+	return *event.ReceivedAt
+}
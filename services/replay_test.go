@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+	"yc-backend/models"
+
+	"github.com/gookit/goutil/testutil/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestReplayWebhooksNeedsAFilter(t *testing.T) {
+	s := &DisbursementService{}
+
+	_, err := s.ReplayWebhooks(context.Background(), WebhookEventFilter{}, true)
+
+	assert.ErrIs(t, err, ErrReplayUnfiltered)
+}
+
+func TestTransitionNote(t *testing.T) {
+	assert.Eq(t, "", transitionNote(models.DisbursementProcessing, models.DisbursementCompleted))
+	assert.Eq(t, "", transitionNote(models.DisbursementCompleted, models.DisbursementCompleted))
+	assert.StrContains(t, transitionNote(models.DisbursementCompleted, models.DisbursementProcessing), ErrIllegalTransition.Error())
+}
+
+func webhookEventDoc(eventID, event string, receivedAt time.Time) bson.D {
+	return bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "event_id", Value: eventID},
+		{Key: "event", Value: event},
+		{Key: "sequence_id", Value: "seq-1"},
+		{Key: "signature_valid", Value: true},
+		{Key: "received_at", Value: receivedAt},
+	}
+}
+
+func TestFoldWebhookStatusesFollowsStateMachine(t *testing.T) {
+	now := time.Now()
+	events := []models.WebhookEvent{
+		{EventID: "1", Event: models.PaymentProcessingEvent, SignatureValid: true},
+		{EventID: "2", Event: models.PaymentFailedEvent, SignatureValid: true},
+		{EventID: "3", Event: models.PaymentCompletedEvent, SignatureValid: false},
+		{EventID: "4", Event: models.PaymentPendingEvent, SignatureValid: true, ReceivedAt: &now},
+	}
+
+	status, last := foldWebhookStatuses(models.DisbursementPending, events)
+
+	assert.Eq(t, models.DisbursementFailed, status)
+	assert.Eq(t, "2", last.EventID)
+
+	status, last = foldWebhookStatuses(models.DisbursementPending, nil)
+	assert.Eq(t, models.DisbursementPending, status)
+	assert.Nil(t, last)
+}
+
+func TestRebuildWebhookStatusesMovesOutOfTerminalStatus(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("completed by a bug, failed by its events", func(mt *mtest.T) {
+		received := time.Now().Add(-time.Hour)
+		processing := webhookEventDoc("evt-1", models.PaymentProcessingEvent, received)
+		failed := webhookEventDoc("evt-2", models.PaymentFailedEvent, received.Add(time.Minute))
+		disbursementID := primitive.NewObjectID()
+		disbursement := bson.D{
+			{Key: "_id", Value: disbursementID},
+			{Key: "status", Value: models.DisbursementCompleted},
+			{Key: "payment", Value: bson.D{{Key: "sequenceid", Value: "seq-1"}}},
+			{Key: "status_history", Value: bson.A{
+				bson.D{{Key: "status", Value: models.DisbursementPending}, {Key: "source", Value: models.StatusSourceAPI}},
+				bson.D{{Key: "status", Value: models.DisbursementCompleted}, {Key: "source", Value: models.StatusSourceWebhook}},
+			}},
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "yc.webhook_events", mtest.FirstBatch, failed),
+			mtest.CreateCursorResponse(0, "yc.disbursements", mtest.FirstBatch, disbursement),
+			mtest.CreateCursorResponse(0, "yc.webhook_events", mtest.FirstBatch, failed, processing),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+				{Key: "_id", Value: disbursementID},
+				{Key: "status", Value: models.DisbursementFailed},
+			}}),
+		)
+
+		replay, err := mockService(mt).RebuildWebhookStatuses(context.Background(), WebhookEventFilter{SequenceID: "seq-1"}, false)
+
+		assert.NoErr(t, err)
+		assert.True(t, replay.Force)
+		assert.Eq(t, 1, replay.Changed)
+		assert.Len(t, replay.Results, 1)
+		result := replay.Results[0]
+		assert.Eq(t, models.DisbursementCompleted, result.From)
+		assert.Eq(t, models.DisbursementFailed, result.To)
+		assert.Eq(t, "evt-2", result.EventID)
+
+		updates := findAndModifyUpdates(mt)
+		assert.Len(t, updates, 1)
+		assert.Eq(t, string(models.DisbursementCompleted), updates[0].Lookup("query", "status").StringValue())
+		assert.Eq(t, string(models.DisbursementFailed), updates[0].Lookup("update", "$set", "status").StringValue())
+		assert.Eq(t, models.StatusSourceReplay, updates[0].Lookup("update", "$push", "status_history", "source").StringValue())
+	})
+}
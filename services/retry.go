@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+	"yc-backend/models"
+	"yc-backend/pkg"
+
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrNotRetryable   = errors.New("only failed disbursements can be retried")
+	ErrAlreadyRetried = errors.New("disbursement has already been retried")
+	// ErrAttemptReceived refuses to retry a failed disbursement whose payment
+	// Yellow Card received after all.
+	ErrAttemptReceived = errors.New("the failed attempt reached Yellow Card, so it cannot be retried")
+	// ErrRetryUnconfirmed refuses to retry while it cannot be confirmed that
+	// the failed attempt never reached Yellow Card.
+	ErrRetryUnconfirmed = errors.New("could not confirm that the failed attempt never reached Yellow Card")
+)
+
+// Failure reasons recorded for submissions that failed without a Yellow Card
+// error code, in the form of its codes so the retry policy can match them.
+const (
+	FailureTimeout       = "TIMEOUT"
+	FailureServerError   = "SERVER_ERROR"
+	FailureRejected      = "REJECTED"
+	FailureRequestFailed = "REQUEST_FAILED"
+)
+
+// Retry submits a new attempt of a failed disbursement made by the user.
+func (s *DisbursementService) Retry(ctx context.Context, userID, disbursementID primitive.ObjectID) (*models.Disbursement, error) {
+	previous, err := s.FindDisbursement(ctx, userID, disbursementID)
+	if err != nil {
+		return nil, err
+	}
+	return s.retry(ctx, previous)
+}
+
+// retry claims the failed disbursement by linking it to the id of the new attempt
+// before anything is submitted, so a disbursement is never retried twice.
+func (s *DisbursementService) retry(ctx context.Context, previous *models.Disbursement) (*models.Disbursement, error) {
+	if previous.Status != models.DisbursementFailed {
+		return nil, ErrNotRetryable
+	}
+	if err := s.confirmNotReceived(ctx, previous); err != nil {
+		return nil, err
+	}
+
+	retryId := primitive.NewObjectID()
+	claimed, err := s.repos.Disbursement.FindOneAndUpdate(ctx,
+		bson.D{
+			{Key: "_id", Value: previous.ID},
+			{Key: "status", Value: models.DisbursementFailed},
+			{Key: "retried_by", Value: bson.D{{Key: "$exists", Value: false}}},
+		},
+		bson.D{
+			{Key: "$set", Value: bson.D{{Key: "retried_by", Value: retryId}}},
+			{Key: "$unset", Value: bson.D{{Key: "next_retry_at", Value: ""}}},
+		})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrAlreadyRetried
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	release := func() {
+		if _, err := s.repos.Disbursement.FindOneAndUpdate(ctx,
+			bson.D{{Key: "_id", Value: previous.ID}},
+			bson.D{{Key: "$unset", Value: bson.D{{Key: "retried_by", Value: ""}}}}); err != nil {
+			s.logger.Errorf("could not release retry claim on disbursement [%s]: %v", previous.ID.Hex(), err)
+		}
+	}
+
+	if !claimed.ParentID.IsZero() {
+		retry, err := s.retryPart(ctx, claimed, retryId)
+		if err != nil && retry == nil {
+			release()
+		}
+		return retry, err
+	}
+
+	user, err := s.repos.User.FindOneById(ctx, claimed.SenderID)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	employee, err := s.repos.Employee.FindOneById(ctx, claimed.ReceiverID)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	retry, err := s.Disburse(ctx, DisbursementRequest{
+		User:         user,
+		Employee:     employee,
+		PayrollRunID: claimed.PayrollRunID,
+		RetryOf:      claimed,
+		ID:           retryId,
+	})
+	if err != nil && retry == nil {
+		release()
+	}
+	return retry, err
+}
+
+// confirmNotReceived makes sure a failed disbursement Yellow Card never
+// returned a payment for did not reach it, by looking the payment up by its
+// sequenceId. A payment that did reach it is never retried, automatically or
+// not. Split disbursements are confirmed part by part.
+func (s *DisbursementService) confirmNotReceived(ctx context.Context, previous *models.Disbursement) error {
+	if previous.Payment.ID != "" || previous.PaymentRequest == nil || len(previous.SplitAmounts) > 0 {
+		return nil
+	}
+	payment, err := s.client.GetPaymentBySequenceID(previous.PaymentRequest.SequenceID)
+	if errors.Is(err, pkg.ErrPaymentNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRetryUnconfirmed, err)
+	}
+
+	s.logger.Errorf("failed disbursement [%s] reached Yellow Card as payment [%s] with status %s",
+		previous.ID.Hex(), payment.ID, payment.Status)
+	if previous.NextRetryAt != nil {
+		if _, err := s.repos.Disbursement.FindOneAndUpdate(ctx,
+			bson.D{{Key: "_id", Value: previous.ID}},
+			bson.D{{Key: "$unset", Value: bson.D{{Key: "next_retry_at", Value: ""}}}}); err != nil {
+			s.logger.Errorf("could not cancel automatic retry of disbursement [%s]: %v", previous.ID.Hex(), err)
+		}
+	}
+	return fmt.Errorf("%w: payment [%s] is %s", ErrAttemptReceived, payment.ID, payment.Status)
+}
+
+// failureReason is the reason recorded for a failed submission: the Yellow
+// Card error code when the response has one, or else what kind of failure it was.
+func failureReason(err error) string {
+	var (
+		apiErr *pkg.APIError
+		netErr net.Error
+	)
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Code != "":
+		return apiErr.Code
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusRequestTimeout:
+		return FailureTimeout
+	case errors.As(err, &apiErr) && apiErr.StatusCode >= http.StatusInternalServerError:
+		return FailureServerError
+	case errors.As(err, &apiErr):
+		return FailureRejected
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return FailureTimeout
+	default:
+		return FailureRequestFailed
+	}
+}
+
+// scheduleRetry records why a disbursement failed and, when the reason is one of
+// the configured transient reasons and attempts remain, when it should be retried.
+func (s *DisbursementService) scheduleRetry(ctx context.Context, disbursement *models.Disbursement, reason string) {
+	update := models.Disbursement{FailureReason: reason}
+
+	policy := s.cfg.Retry
+	attempt := max(disbursement.Attempt, 1)
+	if attempt < policy.MaxAttempts && lo.Contains(policy.TransientReasons, reason) {
+		backoff := time.Duration(policy.Backoff) * time.Second << (attempt - 1)
+		nextRetryAt := time.Now().Add(backoff)
+		update.NextRetryAt = &nextRetryAt
+		s.logger.Infof("disbursement [%s] failed with %s, retrying at %v", disbursement.ID.Hex(), reason, nextRetryAt)
+	}
+
+	if update.FailureReason == "" && update.NextRetryAt == nil {
+		return
+	}
+	if err := s.repos.Disbursement.UpdateOneById(ctx, disbursement.ID, update); err != nil {
+		s.logger.Errorf("could not record failure of disbursement [%s]: %v", disbursement.ID.Hex(), err)
+	}
+}
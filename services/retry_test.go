@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	"yc-backend/common"
+	"yc-backend/models"
+	"yc-backend/pkg"
+
+	"github.com/gookit/goutil/testutil/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestFailureReasonIsStable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"yellow card code", &pkg.APIError{StatusCode: http.StatusServiceUnavailable, Code: "PROVIDER_UNAVAILABLE"}, "PROVIDER_UNAVAILABLE"},
+		{"server error", &pkg.APIError{StatusCode: http.StatusBadGateway, Body: "<html>bad gateway</html>"}, FailureServerError},
+		{"request timeout", &pkg.APIError{StatusCode: http.StatusRequestTimeout}, FailureTimeout},
+		{"rejected", &pkg.APIError{StatusCode: http.StatusBadRequest}, FailureRejected},
+		{"client timeout", fmt.Errorf("post: %w", context.DeadlineExceeded), FailureTimeout},
+		{"connection reset", errors.New("connection reset by peer"), FailureRequestFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Eq(t, tt.want, failureReason(tt.err))
+		})
+	}
+}
+
+func TestScheduleRetryMatchesFailureReason(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("server error", func(mt *mtest.T) {
+		svc := mockService(mt)
+		svc.cfg = &common.Config{}
+		svc.cfg.Retry.MaxAttempts = 3
+		svc.cfg.Retry.Backoff = 60
+		svc.cfg.Retry.TransientReasons = []string{FailureServerError}
+		disbursement := createdDisbursement()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(statusDoc(disbursement, models.DisbursementFailed)))
+
+		svc.scheduleRetry(context.Background(), disbursement,
+			failureReason(&pkg.APIError{StatusCode: http.StatusServiceUnavailable, Body: "failed to submit payment"}))
+
+		updates := findAndModifyUpdates(mt)
+		assert.Len(t, updates, 1)
+		assert.Eq(t, FailureServerError, updates[0].Lookup("update", "$set", "failure_reason").StringValue())
+		_, scheduled := updates[0].Lookup("update", "$set", "next_retry_at").TimeOK()
+		assert.True(t, scheduled)
+	})
+}
+
+func TestRetryRefusesAttemptThatReachedYellowCard(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("payment found", func(mt *mtest.T) {
+		svc, lookups := submittingService(t, mt, http.StatusOK, http.StatusOK, `{"id": "payment-1", "status": "complete"}`)
+		previous := createdDisbursement()
+		previous.Status = models.DisbursementFailed
+		nextRetryAt := time.Now()
+		previous.NextRetryAt = &nextRetryAt
+		mt.AddMockResponses(mtest.CreateSuccessResponse(statusDoc(previous, models.DisbursementFailed)))
+
+		retry, err := svc.retry(context.Background(), previous)
+
+		assert.Nil(t, retry)
+		assert.True(t, errors.Is(err, ErrAttemptReceived))
+		assert.Eq(t, 1, *lookups)
+		// the automatic retry is cancelled and the disbursement is never claimed
+		updates := findAndModifyUpdates(mt)
+		assert.Len(t, updates, 1)
+		_, err = updates[0].LookupErr("update", "$unset", "next_retry_at")
+		assert.NoErr(t, err)
+		_, claimed := updates[0].Lookup("update", "$set", "retried_by").ObjectIDOK()
+		assert.False(t, claimed)
+	})
+
+	mt.Run("lookup fails", func(mt *mtest.T) {
+		svc, _ := submittingService(t, mt, http.StatusOK, http.StatusBadGateway, `{}`)
+		previous := createdDisbursement()
+		previous.Status = models.DisbursementFailed
+
+		retry, err := svc.retry(context.Background(), previous)
+
+		assert.Nil(t, retry)
+		assert.True(t, errors.Is(err, ErrRetryUnconfirmed))
+		assert.Len(t, mt.GetAllStartedEvents(), 0)
+	})
+}
+
+func TestRetryClaimsAttemptYellowCardNeverReceived(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("payment not found", func(mt *mtest.T) {
+		svc, lookups := submittingService(t, mt, http.StatusOK, http.StatusNotFound, `{}`)
+		previous := createdDisbursement()
+		previous.Status = models.DisbursementFailed
+		// already retried by someone else, so the claim matches nothing
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+
+		_, err := svc.retry(context.Background(), previous)
+
+		assert.True(t, errors.Is(err, ErrAlreadyRetried))
+		assert.Eq(t, 1, *lookups)
+	})
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+	"yc-backend/models"
+	"yc-backend/pkg"
+
+	"github.com/samber/lo"
+)
+
+var (
+	ErrNoChannel = errors.New("no active payment channel")
+	ErrNoNetwork = errors.New("no active network")
+)
+
+const (
+	activeStatus     = "active"
+	withdrawRampType = "withdraw"
+)
+
+// PaymentRoute is the Yellow Card channel and network an employee is paid through.
+type PaymentRoute struct {
+	Channel pkg.Channel
+	Network pkg.Network
+}
+
+// paymentRoutes holds the Yellow Card channels and networks so that a payroll
+// run resolves the routes of all its employees from a single fetch.
+type paymentRoutes struct {
+	channels []pkg.Channel
+	networks []pkg.Network
+
+	client    *pkg.YellowClient
+	ratesOnce sync.Once
+	rates     []pkg.Rate
+	ratesErr  error
+}
+
+func (s *DisbursementService) loadRoutes() (*paymentRoutes, error) {
+	channels, err := s.client.GetYellowCardChannels()
+	if err != nil {
+		return nil, err
+	}
+	networks, err := s.client.GetYellowCardNetworks()
+	if err != nil {
+		return nil, err
+	}
+	return &paymentRoutes{channels: channels, networks: networks, client: s.client}, nil
+}
+
+// ResolveRoute finds the active channel and network the employee can be paid
+// through, from their country, payout currency, payout method and bank or
+// mobile money operator, or from their stored network ID.
+func (s *DisbursementService) ResolveRoute(ctx context.Context, employee *models.Employee) (*PaymentRoute, error) {
+	routes, err := s.loadRoutes()
+	if err != nil {
+		return nil, err
+	}
+	return routes.resolve(employee)
+}
+
+func (r *paymentRoutes) resolve(employee *models.Employee) (*PaymentRoute, error) {
+	accountType := PayoutMethod(employee)
+
+	channels := lo.Filter(r.channels, func(channel pkg.Channel, _ int) bool {
+		return channel.Status == activeStatus &&
+			channel.RampType == withdrawRampType &&
+			strings.EqualFold(channel.Country, employee.Country) &&
+			strings.EqualFold(channel.ChannelType, accountType) &&
+			(employee.Currency == "" || strings.EqualFold(channel.Currency, employee.Currency))
+	})
+	if len(channels) == 0 && employee.Currency != "" {
+		return nil, fmt.Errorf("%w for %s payouts in %s in country [%s]", ErrNoChannel, accountType, employee.Currency, employee.Country)
+	}
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("%w for %s payouts in country [%s]", ErrNoChannel, accountType, employee.Country)
+	}
+	channelIds := lo.Map(channels, func(channel pkg.Channel, _ int) string { return channel.ID })
+
+	networks := lo.Filter(r.networks, func(network pkg.Network, _ int) bool {
+		return network.Status == activeStatus &&
+			strings.EqualFold(network.Country, employee.Country) &&
+			takesAccountNumbersOf(network, accountType) &&
+			lo.Some(network.ChannelIds, channelIds)
+	})
+
+	var (
+		network pkg.Network
+		ok      bool
+	)
+	if employee.NetworkID != "" {
+		network, ok = lo.Find(networks, func(network pkg.Network) bool { return network.ID == employee.NetworkID })
+		if !ok {
+			return nil, fmt.Errorf("%w with id [%s] for %s payouts in country [%s]", ErrNoNetwork, employee.NetworkID, accountType, employee.Country)
+		}
+	} else {
+		network, ok = matchNetwork(networks, employee.BankName)
+		if !ok {
+			return nil, fmt.Errorf("%w matches [%s] for %s payouts in country [%s]", ErrNoNetwork, employee.BankName, accountType, employee.Country)
+		}
+	}
+
+	channel, _ := lo.Find(channels, func(channel pkg.Channel) bool {
+		return lo.Contains(network.ChannelIds, channel.ID)
+	})
+	return &PaymentRoute{Channel: channel, Network: network}, nil
+}
+
+// matchNetwork finds the network named like the bank, ignoring case, spacing
+// and punctuation. A name contained in the bank name, or the other way round,
+// only matches when no other network does.
+func matchNetwork(networks []pkg.Network, bankName string) (pkg.Network, bool) {
+	bank := normalizeName(bankName)
+	if bank == "" {
+		return pkg.Network{}, false
+	}
+	if network, ok := lo.Find(networks, func(network pkg.Network) bool {
+		return normalizeName(network.Name) == bank
+	}); ok {
+		return network, true
+	}
+
+	partial := lo.Filter(networks, func(network pkg.Network, _ int) bool {
+		name := normalizeName(network.Name)
+		return name != "" && (strings.Contains(name, bank) || strings.Contains(bank, name))
+	})
+	if len(partial) != 1 {
+		return pkg.Network{}, false
+	}
+	return partial[0], true
+}
+
+func normalizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
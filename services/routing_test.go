@@ -0,0 +1,53 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"yc-backend/models"
+	"yc-backend/pkg"
+
+	"github.com/gookit/goutil/testutil/assert"
+)
+
+var testRoutes = &paymentRoutes{
+	channels: []pkg.Channel{
+		{ID: "ng-bank", Country: "NG", ChannelType: "bank", RampType: "withdraw", Status: "active"},
+		{ID: "ng-deposit", Country: "NG", ChannelType: "bank", RampType: "deposit", Status: "active"},
+		{ID: "gh-bank", Country: "GH", ChannelType: "bank", RampType: "withdraw", Status: "inactive"},
+	},
+	networks: []pkg.Network{
+		{ID: "gtb", Name: "Guaranty Trust Bank", Country: "NG", Status: "active", ChannelIds: []string{"ng-bank"}},
+		{ID: "access", Name: "Access Bank", Country: "NG", Status: "active", ChannelIds: []string{"ng-bank"}},
+		{ID: "access-diamond", Name: "Access Bank (Diamond)", Country: "NG", Status: "active", ChannelIds: []string{"ng-bank"}},
+		{ID: "zenith", Name: "Zenith Bank", Country: "NG", Status: "inactive", ChannelIds: []string{"ng-bank"}},
+	},
+}
+
+func TestResolveRouteMatchesBankName(t *testing.T) {
+	route, err := testRoutes.resolve(&models.Employee{Country: "ng", AccountType: "bank", BankName: "guaranty trust bank"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ng-bank", route.Channel.ID)
+	assert.Equal(t, "gtb", route.Network.ID)
+}
+
+func TestResolveRoutePrefersStoredNetwork(t *testing.T) {
+	route, err := testRoutes.resolve(&models.Employee{Country: "NG", BankName: "Access", NetworkID: "access-diamond"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "access-diamond", route.Network.ID)
+}
+
+func TestResolveRouteRejectsAmbiguousAndInactiveNetworks(t *testing.T) {
+	_, err := testRoutes.resolve(&models.Employee{Country: "NG", BankName: "Access"})
+	assert.True(t, errors.Is(err, ErrNoNetwork))
+
+	_, err = testRoutes.resolve(&models.Employee{Country: "NG", BankName: "Zenith Bank"})
+	assert.True(t, errors.Is(err, ErrNoNetwork))
+}
+
+func TestResolveRouteWithoutActiveChannel(t *testing.T) {
+	_, err := testRoutes.resolve(&models.Employee{Country: "GH", BankName: "GCB Bank"})
+
+	assert.True(t, errors.Is(err, ErrNoChannel))
+}
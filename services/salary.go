@@ -0,0 +1,135 @@
+package services
+
+import (
+	"math"
+	"strings"
+	"yc-backend/models"
+
+	"github.com/samber/lo"
+)
+
+const (
+	defaultPensionEmployeeRate = 8.0
+	defaultPensionEmployerRate = 10.0
+
+	// annual income at or below the national minimum wage is exempt from PAYE
+	payeExemptAnnualIncome = 30000 * 12
+	// minimum tax as a fraction of annual gross income
+	payeMinimumTaxRate = 0.01
+)
+
+type taxBand struct {
+	width float64
+	rate  float64
+}
+
+// payeBands are the annual PAYE bands of the Personal Income Tax Act. The last
+// band applies to all remaining income.
+var payeBands = []taxBand{
+	{width: 300000, rate: 0.07},
+	{width: 300000, rate: 0.11},
+	{width: 500000, rate: 0.15},
+	{width: 500000, rate: 0.19},
+	{width: 1600000, rate: 0.21},
+	{width: math.Inf(1), rate: 0.24},
+}
+
+// ComputePay works out the employee's monthly pay from gross to net. Employees
+// without pay components are paid their flat salary with no deductions. The
+// Nigerian pension and PAYE rules only apply to employees in Nigeria; elsewhere
+// just the employee's own deductions are taken.
+func ComputePay(employee *models.Employee) models.PayBreakdown {
+	components := employee.PayComponents
+	if components == nil {
+		return models.PayBreakdown{
+			Earnings: []models.PayItem{{Name: "salary", Amount: employee.Salary}},
+			Gross:    employee.Salary,
+			Net:      employee.Salary,
+		}
+	}
+
+	var breakdown models.PayBreakdown
+	for _, earning := range append([]models.PayItem{
+		{Name: "basic", Amount: components.Basic},
+		{Name: "housing", Amount: components.Housing},
+		{Name: "transport", Amount: components.Transport},
+	}, components.OtherAllowances...) {
+		if earning.Amount == 0 {
+			continue
+		}
+		breakdown.Earnings = append(breakdown.Earnings, earning)
+		breakdown.Gross += earning.Amount
+	}
+
+	statutory := nigerian(employee.Country)
+	if !components.PensionExempt && statutory {
+		pensionable := components.Basic + components.Housing + components.Transport
+		breakdown.PensionEmployee = round2(pensionable * rateOrDefault(components.PensionEmployeeRate, defaultPensionEmployeeRate) / 100)
+		breakdown.PensionEmployer = round2(pensionable * rateOrDefault(components.PensionEmployerRate, defaultPensionEmployerRate) / 100)
+		if breakdown.PensionEmployee > 0 {
+			breakdown.Deductions = append(breakdown.Deductions, models.PayItem{Name: "pension", Amount: breakdown.PensionEmployee})
+		}
+	}
+
+	if !components.TaxExempt && statutory {
+		breakdown.PAYE = monthlyPAYE(breakdown.Gross, breakdown.PensionEmployee)
+		if breakdown.PAYE > 0 {
+			breakdown.Deductions = append(breakdown.Deductions, models.PayItem{Name: "paye", Amount: breakdown.PAYE})
+		}
+	}
+
+	breakdown.Deductions = append(breakdown.Deductions, components.Deductions...)
+	for _, deduction := range breakdown.Deductions {
+		breakdown.TotalDeductions += deduction.Amount
+	}
+
+	breakdown.Gross = round2(breakdown.Gross)
+	breakdown.TotalDeductions = round2(breakdown.TotalDeductions)
+	breakdown.Net = round2(math.Max(breakdown.Gross-breakdown.TotalDeductions, 0))
+	return breakdown
+}
+
+// monthlyPAYE computes PAYE on an annualised salary: the consolidated relief
+// allowance and pension are deducted before the bands apply, and the result is
+// never below the minimum tax.
+func monthlyPAYE(monthlyGross, monthlyPension float64) float64 {
+	annualGross := monthlyGross * 12
+	if annualGross <= payeExemptAnnualIncome {
+		return 0
+	}
+
+	annualPension := monthlyPension * 12
+	reliefBase := annualGross - annualPension
+	relief := math.Max(200000, 0.01*reliefBase) + 0.2*reliefBase
+	taxable := annualGross - annualPension - relief
+
+	tax := 0.0
+	for _, band := range payeBands {
+		if taxable <= 0 {
+			break
+		}
+		portion := math.Min(taxable, band.width)
+		tax += portion * band.rate
+		taxable -= portion
+	}
+
+	tax = math.Max(tax, annualGross*payeMinimumTaxRate)
+	return round2(tax / 12)
+}
+
+// nigerian reports whether the country is Nigeria; employees without a
+// country predate multi-country payroll and are all paid in Nigeria.
+func nigerian(country string) bool {
+	return lo.Contains([]string{"", "NG", "NGA", "NIGERIA"}, strings.ToUpper(strings.TrimSpace(country)))
+}
+
+func rateOrDefault(rate, fallback float64) float64 {
+	if rate == 0 {
+		return fallback
+	}
+	return rate
+}
+
+func round2(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"testing"
+	"yc-backend/models"
+
+	"github.com/gookit/goutil/testutil/assert"
+)
+
+func TestComputePayWithoutComponentsPaysFlatSalary(t *testing.T) {
+	breakdown := ComputePay(&models.Employee{Salary: 250000})
+
+	assert.Equal(t, 250000.0, breakdown.Gross)
+	assert.Equal(t, 0.0, breakdown.TotalDeductions)
+	assert.Equal(t, 250000.0, breakdown.Net)
+}
+
+func TestComputePayGrossToNet(t *testing.T) {
+	breakdown := ComputePay(&models.Employee{PayComponents: &models.PayComponents{
+		Basic:      300000,
+		Housing:    100000,
+		Transport:  100000,
+		Deductions: []models.PayItem{{Name: "loan", Amount: 5000}},
+	}})
+
+	assert.Equal(t, 500000.0, breakdown.Gross)
+	assert.Equal(t, 40000.0, breakdown.PensionEmployee)
+	assert.Equal(t, 50000.0, breakdown.PensionEmployer)
+	assert.Equal(t, 66986.67, breakdown.PAYE)
+	assert.Equal(t, 111986.67, breakdown.TotalDeductions)
+	assert.Equal(t, 388013.33, breakdown.Net)
+	assert.Len(t, breakdown.Deductions, 3)
+}
+
+func TestComputePayMinimumWageIsTaxExempt(t *testing.T) {
+	breakdown := ComputePay(&models.Employee{PayComponents: &models.PayComponents{
+		Basic:         30000,
+		PensionExempt: true,
+	}})
+
+	assert.Equal(t, 0.0, breakdown.PAYE)
+	assert.Equal(t, 30000.0, breakdown.Net)
+}
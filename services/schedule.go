@@ -0,0 +1,298 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"yc-backend/common"
+	"yc-backend/internals"
+	"yc-backend/models"
+	"yc-backend/repository"
+
+	_ "time/tzdata"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DefaultPayTimezone      = "Africa/Lagos"
+	defaultSchedulerTick    = time.Minute
+	maxScheduleLookaheadMon = 24
+	// executionStaleAfter is how long a payday can be executing without its
+	// payroll run before another tick takes it over.
+	executionStaleAfter = 10 * time.Minute
+)
+
+var errExecutionInProgress = errors.New("payday is being executed by another process")
+
+// NextPayday returns the first payday of the schedule strictly after t.
+func NextPayday(schedule *models.PaySchedule, t time.Time) (time.Time, error) {
+	timezone := schedule.Timezone
+	if timezone == "" {
+		timezone = DefaultPayTimezone
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	local := t.In(loc)
+	for i := 0; i <= maxScheduleLookaheadMon; i++ {
+		payday, err := paydayInMonth(schedule, local.Year(), local.Month()+time.Month(i), loc)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if payday.After(t) {
+			return payday, nil
+		}
+	}
+	return time.Time{}, errors.New("could not determine next payday")
+}
+
+func paydayInMonth(schedule *models.PaySchedule, year int, month time.Month, loc *time.Location) (time.Time, error) {
+	lastDay := time.Date(year, month+1, 0, schedule.Hour, schedule.Minute, 0, 0, loc)
+	switch schedule.Rule {
+	case models.PayDayLastBusinessDay:
+		payday := lastDay
+		for payday.Weekday() == time.Saturday || payday.Weekday() == time.Sunday {
+			payday = payday.AddDate(0, 0, -1)
+		}
+		return payday, nil
+	case models.PayDayDayOfMonth:
+		day := schedule.DayOfMonth
+		if day > lastDay.Day() {
+			day = lastDay.Day()
+		}
+		return time.Date(year, month, day, schedule.Hour, schedule.Minute, 0, 0, loc), nil
+	default:
+		return time.Time{}, fmt.Errorf("unknown pay schedule rule [%s]", schedule.Rule)
+	}
+}
+
+// PayrollScheduler periodically triggers payroll runs for every active pay
+// schedule whose payday has passed, catching up on paydays missed while the
+// server was down.
+type PayrollScheduler struct {
+	svc      *DisbursementService
+	repos    *repository.Repositories
+	logger   internals.Logger
+	interval time.Duration
+}
+
+// NewPayrollScheduler constructor
+func NewPayrollScheduler(cfg *common.Config, repos *repository.Repositories, logger internals.Logger) *PayrollScheduler {
+	interval := time.Duration(cfg.Payroll.SchedulerInterval) * time.Second
+	if interval <= 0 {
+		interval = defaultSchedulerTick
+	}
+	return &PayrollScheduler{
+		svc:      NewDisbursementService(cfg, repos, logger),
+		repos:    repos,
+		logger:   logger,
+		interval: interval,
+	}
+}
+
+// Run checks the schedules immediately and then on every tick until ctx is cancelled.
+func (ps *PayrollScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(ps.interval)
+	defer ticker.Stop()
+
+	ps.logger.Infof("payroll scheduler started, checking every %v", ps.interval)
+	for {
+		ps.tick(ctx)
+		select {
+		case <-ctx.Done():
+			ps.logger.Infof("payroll scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (ps *PayrollScheduler) tick(ctx context.Context) {
+	now := time.Now()
+	schedules, err := ps.repos.PaySchedule.FindMany(ctx, bson.D{
+		{Key: "status", Value: models.PayScheduleActive},
+		{Key: "next_run_at", Value: bson.D{{Key: "$lte", Value: now}}},
+	})
+	if err != nil {
+		ps.logger.Errorf("payroll scheduler could not load schedules: %v", err)
+		return
+	}
+
+	for i := range schedules {
+		if ctx.Err() != nil {
+			return
+		}
+		ps.runDue(ctx, &schedules[i], now)
+	}
+}
+
+func (ps *PayrollScheduler) runDue(ctx context.Context, schedule *models.PaySchedule, now time.Time) {
+	payday := *schedule.NextRunAt
+	for !payday.After(now) {
+		catchUp := now.Sub(payday) > 2*ps.interval
+		if catchUp {
+			ps.logger.Warningf("pay schedule [%s] missed payday %v, catching up", schedule.ID.Hex(), payday)
+		}
+		if err := ps.execute(ctx, schedule, payday, catchUp); err != nil {
+			ps.logger.Errorf("pay schedule [%s] payday %v failed: %v", schedule.ID.Hex(), payday, err)
+			// retried on the next tick, unless there is nobody to pay
+			if !errors.Is(err, ErrNoEmployees) {
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		next, err := NextPayday(schedule, payday)
+		if err != nil {
+			ps.logger.Errorf("pay schedule [%s] has no next payday: %v", schedule.ID.Hex(), err)
+			return
+		}
+		lastRunAt := payday
+		schedule.NextRunAt = &next
+		schedule.LastRunAt = &lastRunAt
+		if err := ps.repos.PaySchedule.UpdateOneById(ctx, schedule.ID, models.PaySchedule{
+			NextRunAt: schedule.NextRunAt,
+			LastRunAt: schedule.LastRunAt,
+		}); err != nil {
+			ps.logger.Errorf("could not advance pay schedule [%s]: %v", schedule.ID.Hex(), err)
+			return
+		}
+		payday = next
+	}
+}
+
+// execute pays every active employee for the payday. The execution record,
+// unique on (schedule_id, scheduled_for), reserves the id of the payday's
+// payroll run before the run is created, so a payday is only ever paid once:
+// an execution that failed or stopped before its run was created is taken over
+// by a later tick, and a run that was created is finished by ResumePayrollRuns.
+func (ps *PayrollScheduler) execute(ctx context.Context, schedule *models.PaySchedule, payday time.Time, catchUp bool) error {
+	execution, err := ps.claimExecution(ctx, schedule, payday, catchUp)
+	if err != nil || execution == nil {
+		return err
+	}
+
+	finish := func(update models.PayScheduleExecution) error {
+		finishedAt := time.Now()
+		update.FinishedAt = &finishedAt
+		return ps.repos.PayExecution.UpdateOneById(ctx, execution.ID, update)
+	}
+
+	user, err := ps.repos.User.FindOneById(ctx, schedule.UserID)
+	if err != nil {
+		finish(models.PayScheduleExecution{Status: models.PayScheduleExecutionFailed, Error: err.Error()})
+		return err
+	}
+
+	run, employees, err := ps.svc.createPayrollRun(ctx, user, execution.PayrollRunID)
+	if err != nil {
+		finish(models.PayScheduleExecution{Status: models.PayScheduleExecutionFailed, Error: err.Error()})
+		return err
+	}
+	ps.svc.ExecutePayrollRun(ctx, run, user, employees)
+	return finish(models.PayScheduleExecution{Status: executionStatus(run)})
+}
+
+// claimExecution records that the payday is being executed and returns the
+// execution, or nil when the payday needs nothing more. An execution without
+// its payroll run is taken over when it failed or has gone stale.
+func (ps *PayrollScheduler) claimExecution(ctx context.Context, schedule *models.PaySchedule, payday time.Time, catchUp bool) (*models.PayScheduleExecution, error) {
+	startedAt := time.Now()
+	execution := models.PayScheduleExecution{
+		ScheduleID:   schedule.ID,
+		UserID:       schedule.UserID,
+		ScheduledFor: &payday,
+		CatchUp:      catchUp,
+		Status:       models.PayScheduleExecutionRunning,
+		PayrollRunID: primitive.NewObjectID(),
+		StartedAt:    &startedAt,
+	}
+	id, err := ps.repos.PayExecution.Create(ctx, execution)
+	if err == nil {
+		execution.ID, _ = id.(primitive.ObjectID)
+		return &execution, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+
+	existing, err := ps.repos.PayExecution.FindOne(ctx, bson.D{
+		{Key: "schedule_id", Value: schedule.ID},
+		{Key: "scheduled_for", Value: payday},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !existing.PayrollRunID.IsZero() {
+		run, err := ps.repos.PayrollRun.FindOneById(ctx, existing.PayrollRunID)
+		if err == nil {
+			ps.logger.Infof("pay schedule [%s] payday %v already has payroll run [%s]", schedule.ID.Hex(), payday, run.ID.Hex())
+			if existing.Status == models.PayScheduleExecutionRunning && run.Status != models.PayrollRunRunning {
+				ps.finishExecution(ctx, existing, run)
+			}
+			return nil, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+	}
+	if existing.Status == models.PayScheduleExecutionCompleted {
+		ps.logger.Infof("pay schedule [%s] payday %v already executed", schedule.ID.Hex(), payday)
+		return nil, nil
+	}
+
+	runID := existing.PayrollRunID
+	if runID.IsZero() {
+		runID = primitive.NewObjectID()
+	}
+	claimed, err := ps.repos.PayExecution.FindOneAndUpdate(ctx,
+		bson.D{
+			{Key: "_id", Value: existing.ID},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "status", Value: models.PayScheduleExecutionFailed}},
+				bson.D{
+					{Key: "status", Value: models.PayScheduleExecutionRunning},
+					{Key: "started_at", Value: bson.D{{Key: "$lte", Value: startedAt.Add(-executionStaleAfter)}}},
+				},
+			}},
+		},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: models.PayScheduleExecutionRunning},
+			{Key: "payroll_run_id", Value: runID},
+			{Key: "started_at", Value: startedAt},
+		}}})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errExecutionInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	ps.logger.Warningf("pay schedule [%s] payday %v did not finish, executing it again", schedule.ID.Hex(), payday)
+	return claimed, nil
+}
+
+// finishExecution records the outcome of a payday whose run was finished by
+// ResumePayrollRuns.
+func (ps *PayrollScheduler) finishExecution(ctx context.Context, execution *models.PayScheduleExecution, run *models.PayrollRun) {
+	if err := ps.repos.PayExecution.UpdateOneById(ctx, execution.ID, models.PayScheduleExecution{
+		Status:     executionStatus(run),
+		FinishedAt: run.CompletedAt,
+	}); err != nil {
+		ps.logger.Errorf("could not finish execution of pay schedule [%s]: %v", execution.ScheduleID.Hex(), err)
+	}
+}
+
+func executionStatus(run *models.PayrollRun) string {
+	if run.Status == models.PayrollRunFailed {
+		return models.PayScheduleExecutionFailed
+	}
+	return models.PayScheduleExecutionCompleted
+}
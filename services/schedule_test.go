@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"yc-backend/models"
+
+	"github.com/gookit/goutil/testutil/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestNextPaydayLastBusinessDay(t *testing.T) {
+	schedule := &models.PaySchedule{
+		Rule:     models.PayDayLastBusinessDay,
+		Hour:     9,
+		Timezone: "Africa/Lagos",
+	}
+	loc, _ := time.LoadLocation("Africa/Lagos")
+
+	// 31 August 2024 is a Saturday, so payday moves back to Friday the 30th.
+	payday, err := NextPayday(schedule, time.Date(2024, time.August, 1, 0, 0, 0, 0, loc))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.August, 30, 9, 0, 0, 0, loc), payday.In(loc))
+
+	// Once the payday has passed the next one is at the end of the following month.
+	payday, err = NextPayday(schedule, time.Date(2024, time.August, 30, 9, 0, 0, 0, loc))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.September, 30, 9, 0, 0, 0, loc), payday.In(loc))
+}
+
+func TestNextPaydayDayOfMonthClampsToMonthEnd(t *testing.T) {
+	schedule := &models.PaySchedule{
+		Rule:       models.PayDayDayOfMonth,
+		DayOfMonth: 31,
+		Hour:       9,
+		Timezone:   "Africa/Lagos",
+	}
+	loc, _ := time.LoadLocation("Africa/Lagos")
+
+	payday, err := NextPayday(schedule, time.Date(2024, time.February, 1, 0, 0, 0, 0, loc))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.February, 29, 9, 0, 0, 0, loc), payday.In(loc))
+}
+
+func TestNextPaydayRejectsUnknownRule(t *testing.T) {
+	_, err := NextPayday(&models.PaySchedule{Rule: "weekly"}, time.Now())
+	assert.Error(t, err)
+}
+
+func mockScheduler(mt *mtest.T) *PayrollScheduler {
+	svc := mockService(mt)
+	return &PayrollScheduler{svc: svc, repos: svc.repos, logger: svc.logger}
+}
+
+func duplicateKeyResponse() bson.D {
+	return mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "E11000 duplicate key error"})
+}
+
+func TestClaimExecutionTakesOverFailedPaydayWithoutRun(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("failed before the run was created", func(mt *mtest.T) {
+		executionID, runID := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(
+			duplicateKeyResponse(),
+			mtest.CreateCursorResponse(0, "yc.pay_schedule_executions", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: executionID},
+				{Key: "status", Value: models.PayScheduleExecutionFailed},
+				{Key: "payroll_run_id", Value: runID},
+			}),
+			mtest.CreateCursorResponse(0, "yc.payroll_runs", mtest.FirstBatch),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+				{Key: "_id", Value: executionID},
+				{Key: "status", Value: models.PayScheduleExecutionRunning},
+				{Key: "payroll_run_id", Value: runID},
+			}}),
+		)
+
+		schedule := &models.PaySchedule{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID()}
+		execution, err := mockScheduler(mt).claimExecution(context.Background(), schedule, time.Now(), false)
+
+		assert.NoError(t, err)
+		assert.NotNil(t, execution)
+		// the retry creates the run under the id reserved by the first attempt
+		assert.Equal(t, runID, execution.PayrollRunID)
+		updates := findAndModifyUpdates(mt)
+		assert.Len(t, updates, 1)
+		assert.Equal(t, runID, updates[0].Lookup("update", "$set", "payroll_run_id").ObjectID())
+	})
+}
+
+func TestClaimExecutionLeavesPaydayInProgress(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("another process is executing it", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			duplicateKeyResponse(),
+			mtest.CreateCursorResponse(0, "yc.pay_schedule_executions", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "status", Value: models.PayScheduleExecutionRunning},
+				{Key: "payroll_run_id", Value: primitive.NewObjectID()},
+			}),
+			mtest.CreateCursorResponse(0, "yc.payroll_runs", mtest.FirstBatch),
+			// started too recently to be taken over
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+		)
+
+		schedule := &models.PaySchedule{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID()}
+		execution, err := mockScheduler(mt).claimExecution(context.Background(), schedule, time.Now(), false)
+
+		assert.Nil(t, execution)
+		assert.True(t, errors.Is(err, errExecutionInProgress))
+	})
+}
+
+func TestClaimExecutionSkipsPaydayWithRun(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("run already created", func(mt *mtest.T) {
+		runID := primitive.NewObjectID()
+		mt.AddMockResponses(
+			duplicateKeyResponse(),
+			mtest.CreateCursorResponse(0, "yc.pay_schedule_executions", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "status", Value: models.PayScheduleExecutionFailed},
+				{Key: "payroll_run_id", Value: runID},
+			}),
+			mtest.CreateCursorResponse(0, "yc.payroll_runs", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: runID},
+				{Key: "status", Value: models.PayrollRunFailed},
+			}),
+		)
+
+		schedule := &models.PaySchedule{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID()}
+		execution, err := mockScheduler(mt).claimExecution(context.Background(), schedule, time.Now(), false)
+
+		assert.NoError(t, err)
+		assert.Nil(t, execution)
+		assert.Len(t, findAndModifyUpdates(mt), 0)
+	})
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+	"yc-backend/common"
+	"yc-backend/models"
+	"yc-backend/pkg"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrBelowChannelMinimum = errors.New("amount is below the channel minimum")
+	ErrSplitQuote          = errors.New("payments above the channel maximum cannot be quoted")
+)
+
+// paymentParts is the number of payments the channel needs to pay the amount.
+// A zero Max means the channel has no upper limit.
+func paymentParts(amount float64, channel pkg.Channel) int {
+	if channel.Max <= 0 || amount <= channel.Max {
+		return 1
+	}
+	return int(math.Ceil(amount / channel.Max))
+}
+
+// splitAmount divides the amount into the fewest payments the channel accepts,
+// as equal as the cents allow. Every payment must be within the channel's
+// limits, which rules out amounts just above Max on a channel whose Min is more
+// than half its Max.
+func splitAmount(amount float64, channel pkg.Channel) ([]float64, error) {
+	if amount < channel.Min {
+		return nil, fmt.Errorf("%w: %.2f is below the %s minimum of %.2f", ErrBelowChannelMinimum, amount, channel.Currency, channel.Min)
+	}
+
+	parts := paymentParts(amount, channel)
+	cents := int64(math.Round(amount * 100))
+	amounts := make([]float64, parts)
+	for i := range amounts {
+		share := cents / int64(parts)
+		if int64(i) < cents%int64(parts) {
+			share++
+		}
+		amounts[i] = float64(share) / 100
+		if amounts[i] < channel.Min || (channel.Max > 0 && amounts[i] > channel.Max) {
+			return nil, fmt.Errorf("%w: %.2f cannot be split into %s payments of %.2f to %.2f",
+				ErrBelowChannelMinimum, amount, channel.Currency, channel.Min, channel.Max)
+		}
+	}
+	return amounts, nil
+}
+
+// newPart builds a payment of amount to the same employee as the disbursement,
+// with a new sequenceId.
+func newPart(from *models.Disbursement, amount float64) *models.Disbursement {
+	timeNow := time.Now()
+	request := *from.PaymentRequest
+	request.SequenceID = uuid.New().String()
+	request.LocalAmount = amount
+	return &models.Disbursement{
+		ReceiverID:     from.ReceiverID,
+		SenderID:       from.SenderID,
+		InitiatedBy:    from.InitiatedBy,
+		CreatedAt:      &timeNow,
+		UpdatedAt:      &timeNow,
+		SalaryAmount:   amount,
+		PaymentType:    from.PaymentType,
+		Currency:       from.Currency,
+		AppliedRate:    from.AppliedRate,
+		Status:         models.DisbursementCreated,
+		PaymentRequest: &request,
+		Attempt:        1,
+		StatusHistory: []models.StatusChange{{
+			Status:    models.DisbursementCreated,
+			Source:    models.StatusSourceAPI,
+			Timestamp: timeNow,
+		}},
+	}
+}
+
+// submitSplit submits each part of a split disbursement as a child
+// disbursement. A part Yellow Card rejects is marked failed and can be retried
+// on its own; the error of the first such part is returned with the parent.
+// Parts get their sequenceId from the parent's, and parts created before the
+// process stopped are resumed, so submitting the parent again never pays a
+// part twice.
+func (s *DisbursementService) submitSplit(ctx context.Context, parent *models.Disbursement) (*models.Disbursement, error) {
+	created, err := s.repos.Disbursement.FindMany(ctx, bson.D{
+		{Key: "parent_id", Value: parent.ID},
+		{Key: "retry_of", Value: bson.D{{Key: "$exists", Value: false}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	createdParts := lo.KeyBy(created, func(part models.Disbursement) int {
+		return part.Part
+	})
+
+	var submitErr error
+	for i, amount := range parent.SplitAmounts {
+		if part, ok := createdParts[i+1]; ok {
+			if _, err := s.resume(ctx, &part); err != nil && submitErr == nil {
+				submitErr = fmt.Errorf("part %d of %d: %w", part.Part, len(parent.SplitAmounts), err)
+			}
+			continue
+		}
+
+		part := newPart(parent, amount)
+		part.ParentID = parent.ID
+		part.Part = i + 1
+		part.PaymentRequest.SequenceID = fmt.Sprintf("%s-%d", parent.PaymentRequest.SequenceID, part.Part)
+
+		id, err := s.repos.Disbursement.Create(ctx, *part)
+		if err != nil {
+			return nil, err
+		}
+		if partId, ok := id.(primitive.ObjectID); ok {
+			part.ID = partId
+		}
+		if _, err := s.submit(ctx, part); err != nil && submitErr == nil {
+			submitErr = fmt.Errorf("part %d of %d: %w", part.Part, len(parent.SplitAmounts), err)
+		}
+	}
+	s.logger.Infof("disbursement [%s] was split into %d payments", parent.ID.Hex(), len(parent.SplitAmounts))
+
+	if _, err := s.Transition(ctx, parent, models.DisbursementProcessing, models.StatusSourceAPI, ""); err != nil &&
+		!errors.Is(err, ErrStatusConflict) && !errors.Is(err, ErrIllegalTransition) {
+		return nil, err
+	}
+	if err := s.settleSplit(ctx, parent.ID, models.StatusSourceAPI); err != nil {
+		return nil, err
+	}
+	return parent, submitErr
+}
+
+// retryPart submits a new attempt of a failed part of a split disbursement
+// under the same parent.
+func (s *DisbursementService) retryPart(ctx context.Context, previous *models.Disbursement, retryId primitive.ObjectID) (*models.Disbursement, error) {
+	part := newPart(previous, previous.SalaryAmount)
+	part.ID = retryId
+	part.ParentID = previous.ParentID
+	part.Part = previous.Part
+	part.Attempt = max(previous.Attempt, 1) + 1
+	part.RetryOf = previous.ID
+
+	if _, err := s.Preflight(ctx, []models.PaymentRequest{*part.PaymentRequest}); err != nil {
+		return nil, err
+	}
+	if _, err := s.repos.Disbursement.Create(ctx, *part); err != nil {
+		return nil, err
+	}
+	common.RecordIdempotentWrite(ctx)
+	return s.submit(ctx, part)
+}
+
+// DisbursementParts returns the latest attempt of each part of a split disbursement.
+func (s *DisbursementService) DisbursementParts(ctx context.Context, parentID primitive.ObjectID) ([]models.Disbursement, error) {
+	parts, err := s.repos.Disbursement.FindMany(ctx, bson.D{
+		{Key: "parent_id", Value: parentID},
+		{Key: "retried_by", Value: bson.D{{Key: "$exists", Value: false}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if parts == nil {
+		parts = []models.Disbursement{}
+	}
+	return parts, nil
+}
+
+// settleSplit completes a split disbursement once every part has completed, and
+// records on it why a part failed.
+func (s *DisbursementService) settleSplit(ctx context.Context, parentID primitive.ObjectID, source string) error {
+	parent, err := s.repos.Disbursement.FindOneById(ctx, parentID)
+	if err != nil {
+		return err
+	}
+	parts, err := s.DisbursementParts(ctx, parentID)
+	if err != nil {
+		return err
+	}
+	if len(parts) < len(parent.SplitAmounts) {
+		// the parts are still being submitted or retried
+		return nil
+	}
+
+	if failed, ok := lo.Find(parts, func(part models.Disbursement) bool {
+		return part.Status == models.DisbursementFailed
+	}); ok {
+		reason := fmt.Sprintf("part %d of %d failed", failed.Part, len(parent.SplitAmounts))
+		if failed.FailureReason != "" {
+			reason += ": " + failed.FailureReason
+		}
+		if reason != parent.FailureReason {
+			if err := s.repos.Disbursement.UpdateOneById(ctx, parent.ID, models.Disbursement{FailureReason: reason}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !allCompleted(parts) || parent.Status.IsTerminal() {
+		return nil
+	}
+	if _, err := s.Transition(ctx, parent, models.DisbursementCompleted, source, ""); err != nil && !errors.Is(err, ErrStatusConflict) {
+		return err
+	}
+	s.logger.Infof("split disbursement [%s] completed", parent.ID.Hex())
+	return nil
+}
+
+func allCompleted(parts []models.Disbursement) bool {
+	return lo.EveryBy(parts, func(part models.Disbursement) bool {
+		return part.Status == models.DisbursementCompleted
+	})
+}
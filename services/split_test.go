@@ -0,0 +1,80 @@
+package services
+
+import (
+	"testing"
+	"yc-backend/models"
+	"yc-backend/pkg"
+
+	"github.com/gookit/goutil/testutil/assert"
+)
+
+func TestSplitAmountUnderMaxIsOnePayment(t *testing.T) {
+	amounts, err := splitAmount(400000, pkg.Channel{Min: 1000, Max: 500000})
+
+	assert.NoError(t, err)
+	assert.Eq(t, []float64{400000}, amounts)
+}
+
+func TestSplitAmountAboveMaxSpreadsTheCents(t *testing.T) {
+	amounts, err := splitAmount(1000000.01, pkg.Channel{Min: 1000, Max: 500000})
+
+	assert.NoError(t, err)
+	assert.Eq(t, []float64{333333.34, 333333.34, 333333.33}, amounts)
+}
+
+func TestSplitAmountBelowMinFails(t *testing.T) {
+	_, err := splitAmount(500, pkg.Channel{Min: 1000, Max: 500000})
+
+	assert.ErrIs(t, err, ErrBelowChannelMinimum)
+	assert.True(t, IsUnpayable(err))
+}
+
+func TestSplitAmountKeepsEveryPartAboveMin(t *testing.T) {
+	channel := pkg.Channel{Min: 300000, Max: 500000}
+
+	// two parts of 300000.01 fit the channel
+	amounts, err := splitAmount(600000.02, channel)
+	assert.NoError(t, err)
+	assert.Eq(t, []float64{300000.01, 300000.01}, amounts)
+
+	// two parts of 260000 would each be below the minimum
+	_, err = splitAmount(520000, channel)
+	assert.ErrIs(t, err, ErrBelowChannelMinimum)
+	assert.True(t, IsUnpayable(err))
+}
+
+func TestPrepareSplitsAboveChannelMax(t *testing.T) {
+	req := offCycleRequest()
+	req.Amount = 1200000
+	req.routes = &paymentRoutes{
+		channels: []pkg.Channel{{ID: "ng-bank", Country: "NG", ChannelType: "bank", RampType: "withdraw", Status: "active", Max: 500000}},
+		networks: testRoutes.networks,
+	}
+
+	disbursement, err := (&DisbursementService{}).prepare(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1200000.0, disbursement.SalaryAmount)
+	assert.Eq(t, []float64{400000, 400000, 400000}, disbursement.SplitAmounts)
+
+	req.Quote = true
+	_, err = (&DisbursementService{}).prepare(req)
+	assert.ErrIs(t, err, ErrSplitQuote)
+}
+
+func TestNewPartGetsItsOwnSequenceID(t *testing.T) {
+	parent := &models.Disbursement{
+		SalaryAmount:   1000000,
+		PaymentType:    models.PaymentTypeSalary,
+		PaymentRequest: &models.PaymentRequest{SequenceID: "parent", LocalAmount: 1000000},
+	}
+
+	part := newPart(parent, 500000)
+
+	assert.NotEqual(t, "parent", part.PaymentRequest.SequenceID)
+	assert.Equal(t, 500000.0, part.PaymentRequest.LocalAmount)
+	assert.Equal(t, 1000000.0, parent.PaymentRequest.LocalAmount)
+	assert.Equal(t, models.DisbursementCreated, part.Status)
+	assert.True(t, allCompleted([]models.Disbursement{{Status: models.DisbursementCompleted}}))
+	assert.False(t, allCompleted([]models.Disbursement{{Status: models.DisbursementCompleted}, {Status: models.DisbursementFailed}}))
+}
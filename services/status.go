@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"yc-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const maxTransitionAttempts = 3
+
+var (
+	ErrIllegalTransition = errors.New("illegal disbursement status transition")
+	ErrStatusConflict    = errors.New("disbursement status changed concurrently")
+)
+
+// Transition moves the disbursement to the given status and appends the change
+// to its history. Re-applying the current status is a no-op; transitions the
+// state machine does not allow return ErrIllegalTransition. The update only
+// succeeds if the stored status still matches d.Status, so two concurrent
+// events cannot both win.
+func (s *DisbursementService) Transition(ctx context.Context, d *models.Disbursement, to models.DisbursementStatus, source, eventID string) (bool, error) {
+	if d.Status == to {
+		return false, nil
+	}
+	if !d.Status.CanTransitionTo(to) {
+		return false, fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, d.Status, to)
+	}
+
+	timeNow := time.Now()
+	change := models.StatusChange{
+		Status:    to,
+		Source:    source,
+		Timestamp: timeNow,
+		EventID:   eventID,
+	}
+	updated, err := s.repos.Disbursement.FindOneAndUpdate(ctx,
+		bson.D{
+			{Key: "_id", Value: d.ID},
+			{Key: "status", Value: d.Status},
+		},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "status", Value: to},
+				{Key: "updatedAt", Value: timeNow},
+			}},
+			{Key: "$push", Value: bson.D{{Key: "status_history", Value: change}}},
+		})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, ErrStatusConflict
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if countsAgainstLimits(d.Status) && !countsAgainstLimits(to) {
+		s.releaseLimits(ctx, updated)
+	}
+	*d = *updated
+	return true, nil
+}
+
+// WebhookStatus maps a Yellow Card payment event to the disbursement status it represents.
+func WebhookStatus(event string) (models.DisbursementStatus, bool) {
+	switch event {
+	case models.PaymentPendingEvent:
+		return models.DisbursementPending, true
+	case models.PaymentProcessingEvent:
+		return models.DisbursementProcessing, true
+	case models.PaymentCompletedEvent:
+		return models.DisbursementCompleted, true
+	case models.PaymentFailedEvent:
+		return models.DisbursementFailed, true
+	default:
+		return "", false
+	}
+}
+
+// PaymentStatus maps the status of a Yellow Card payment lookup to a disbursement status.
+func PaymentStatus(status string) (models.DisbursementStatus, bool) {
+	switch strings.ToLower(status) {
+	case "pending":
+		return models.DisbursementPending, true
+	case "processing":
+		return models.DisbursementProcessing, true
+	case "complete", "completed":
+		return models.DisbursementCompleted, true
+	case "failed":
+		return models.DisbursementFailed, true
+	case "expired":
+		return models.DisbursementExpired, true
+	case "denied", "cancelled":
+		return models.DisbursementDenied, true
+	default:
+		return "", false
+	}
+}
+
+// StatusUpdate is a payment status reported by Yellow Card, either pushed by a
+// webhook or pulled by the reconciler.
+type StatusUpdate struct {
+	SequenceID string
+	Status     models.DisbursementStatus
+	Source     string
+	EventID    string
+	// Reason is the failure reason reported alongside a failed payment.
+	Reason string
+}
+
+// ApplyStatusUpdate records a status reported by Yellow Card for the disbursement
+// with the update's sequenceId. Illegal transitions are logged and ignored.
+func (s *DisbursementService) ApplyStatusUpdate(ctx context.Context, update StatusUpdate) (*models.Disbursement, error) {
+	var (
+		disbursement *models.Disbursement
+		changed      bool
+		err          error
+	)
+	for attempt := 0; attempt < maxTransitionAttempts; attempt++ {
+		disbursement, err = s.repos.Disbursement.FindOne(ctx, bson.D{{Key: "payment.sequenceid", Value: update.SequenceID}})
+		if err != nil {
+			return nil, err
+		}
+		changed, err = s.Transition(ctx, disbursement, update.Status, update.Source, update.EventID)
+		if !errors.Is(err, ErrStatusConflict) {
+			break
+		}
+	}
+	if errors.Is(err, ErrIllegalTransition) {
+		s.logger.Warningf("ignoring %s update for disbursement [%s]: %v", update.Source, disbursement.ID.Hex(), err)
+		return disbursement, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		s.logger.Infof("disbursement [%s] moved to %s by %s", disbursement.ID.Hex(), update.Status, update.Source)
+		if update.Status == models.DisbursementFailed {
+			s.scheduleRetry(ctx, disbursement, update.Reason)
+		}
+		if !disbursement.ParentID.IsZero() {
+			if err := s.settleSplit(ctx, disbursement.ParentID, update.Source); err != nil {
+				s.logger.Errorf("could not update split disbursement [%s]: %v", disbursement.ParentID.Hex(), err)
+			}
+		}
+	}
+	return disbursement, nil
+}
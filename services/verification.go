@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"yc-backend/models"
+)
+
+var ErrAccountNotVerified = errors.New("employee account is not verified")
+
+// nameMatchThreshold is the lowest similarity at which every part of the
+// employee's first and last name must appear in the resolved account name.
+const nameMatchThreshold = 0.8
+
+// VerifyAccount resolves the employee's bank account with Yellow Card and
+// compares the holder's name with the employee's. Failures to resolve the
+// account are recorded in the verification rather than returned. Mobile money
+// wallets cannot be resolved, so they get no verification.
+func (s *DisbursementService) VerifyAccount(ctx context.Context, employee *models.Employee) *models.AccountVerification {
+	if PayoutMethod(employee) != models.PayoutBank {
+		return nil
+	}
+
+	verification := &models.AccountVerification{Status: models.AccountUnresolved, CheckedAt: time.Now()}
+	switch {
+	case employee.AccountNumber == "":
+		verification.Reason = "the employee has no account number"
+		return verification
+	case employee.NetworkID == "":
+		verification.Reason = "the employee's bank has not been resolved"
+		return verification
+	}
+
+	resolved, err := s.client.ResolveBankAccount(employee.AccountNumber, employee.NetworkID)
+	if err != nil {
+		s.logger.Errorf("could not resolve account of employee [%s]: %v", employee.ID.Hex(), err)
+		verification.Reason = err.Error()
+		return verification
+	}
+	if resolved.AccountName == "" {
+		verification.Reason = "Yellow Card returned no account name"
+		return verification
+	}
+
+	verification.ResolvedName = resolved.AccountName
+	verification.Score = nameMatchScore(employee.FirstName+" "+employee.LastName, resolved.AccountName)
+	verification.Status = models.AccountNameMismatch
+	if verification.Score >= nameMatchThreshold {
+		verification.Status = models.AccountVerified
+	} else {
+		verification.Reason = fmt.Sprintf("account holder [%s] does not match the employee's name", resolved.AccountName)
+	}
+	return verification
+}
+
+// accountVerified returns ErrAccountNotVerified unless the holder of the
+// employee's bank account has been verified.
+func accountVerified(employee *models.Employee) error {
+	if PayoutMethod(employee) != models.PayoutBank {
+		return nil
+	}
+	verification := employee.AccountVerification
+	if verification == nil {
+		return fmt.Errorf("%w: the account has not been checked", ErrAccountNotVerified)
+	}
+	if verification.Status != models.AccountVerified {
+		return fmt.Errorf("%w: %s", ErrAccountNotVerified, verification.Status)
+	}
+	return nil
+}
+
+// nameMatchScore is how well the expected name appears in the account name:
+// the similarity of the worst matching part of the expected name to its
+// closest part of the account name. Order, case and punctuation are ignored,
+// and the account name may contain extra names such as a middle name.
+func nameMatchScore(expected, accountName string) float64 {
+	expectedParts, accountParts := nameParts(expected), nameParts(accountName)
+	if len(expectedParts) == 0 || len(accountParts) == 0 {
+		return 0
+	}
+
+	score := 1.0
+	for _, part := range expectedParts {
+		best := 0.0
+		for _, candidate := range accountParts {
+			best = max(best, similarity(part, candidate))
+		}
+		score = min(score, best)
+	}
+	return round2(score)
+}
+
+func nameParts(name string) []string {
+	return strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+}
+
+// similarity is one minus the edit distance of a and b relative to the longer of them.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"yc-backend/models"
+
+	"github.com/gookit/goutil/testutil/assert"
+)
+
+func TestNameMatchScore(t *testing.T) {
+	// bank records put the surname first and often add middle names
+	assert.Equal(t, 1.0, nameMatchScore("Chinedu Okafor", "OKAFOR CHINEDU EMEKA"))
+	// a single typo in a long name still matches
+	assert.True(t, nameMatchScore("Adebayo Ogunleye", "ADEBAYOR OGUNLEYE") >= nameMatchThreshold)
+	// a different first name does not
+	assert.True(t, nameMatchScore("Ola Adeyemi", "OLU ADEYEMI") < nameMatchThreshold)
+	assert.Equal(t, 0.0, nameMatchScore("Ola Adeyemi", ""))
+}
+
+func TestAccountVerifiedRequiresVerifiedStatus(t *testing.T) {
+	assert.True(t, errors.Is(accountVerified(&models.Employee{}), ErrAccountNotVerified))
+
+	mismatch := &models.Employee{AccountVerification: &models.AccountVerification{Status: models.AccountNameMismatch}}
+	assert.True(t, errors.Is(accountVerified(mismatch), ErrAccountNotVerified))
+
+	verified := &models.Employee{AccountVerification: &models.AccountVerification{Status: models.AccountVerified}}
+	assert.NoError(t, accountVerified(verified))
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+	"yc-backend/models"
+	"yc-backend/repository"
+
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrInvalidSignature = errors.New("validating request to webhook payload failed")
+
+// WebhookPayload is the body Yellow Card posts to the webhook.
+type WebhookPayload struct {
+	ID         string `json:"id"`
+	SequenceID string `json:"sequenceId"`
+	Status     string `json:"status"`
+	ApiKey     string `json:"apiKey"`
+	Event      string `json:"event"`
+	ExecutedAt int64  `json:"executedAt"`
+	ErrorCode  string `json:"errorCode,omitempty"`
+}
+
+// WebhookDelivery is a webhook request as it was received.
+type WebhookDelivery struct {
+	Headers        map[string]string
+	Body           []byte
+	SignatureValid bool
+}
+
+// ReceiveWebhook stores the delivery in the webhook event store and applies it,
+// unless an earlier delivery of the same event was already applied. Deliveries
+// with an invalid signature are stored but never applied.
+func (s *DisbursementService) ReceiveWebhook(ctx context.Context, delivery WebhookDelivery) (*models.WebhookEvent, error) {
+	var payload WebhookPayload
+	parseErr := json.Unmarshal(delivery.Body, &payload)
+
+	event, duplicate, err := s.recordWebhook(ctx, delivery, payload)
+	if err != nil {
+		return nil, err
+	}
+	if duplicate {
+		s.logger.Infof("skipping webhook event [%s], it was already %s", event.EventID, event.Status)
+		return event, nil
+	}
+
+	switch {
+	case !delivery.SignatureValid:
+		err = ErrInvalidSignature
+		s.settleWebhook(ctx, event, models.WebhookEventRejected, err)
+	case parseErr != nil:
+		err = parseErr
+		s.settleWebhook(ctx, event, models.WebhookEventFailed, err)
+	default:
+		var outcome string
+		_, outcome, err = s.processWebhook(ctx, payload)
+		s.settleWebhook(ctx, event, outcome, err)
+	}
+	return event, err
+}
+
+// processWebhook applies the payment event to its disbursement and returns the
+// disbursement together with the outcome to record for the event.
+func (s *DisbursementService) processWebhook(ctx context.Context, payload WebhookPayload) (*models.Disbursement, string, error) {
+	status, ok := WebhookStatus(payload.Event)
+	if !ok {
+		s.logger.Infof("ignoring webhook event [%s]", payload.Event)
+		return nil, models.WebhookEventIgnored, nil
+	}
+
+	disbursement, err := s.ApplyStatusUpdate(ctx, StatusUpdate{
+		SequenceID: payload.SequenceID,
+		Status:     status,
+		Source:     models.StatusSourceWebhook,
+		EventID:    payload.ID,
+		Reason:     payload.ErrorCode,
+	})
+	if err != nil {
+		return nil, models.WebhookEventFailed, err
+	}
+	return disbursement, models.WebhookEventProcessed, nil
+}
+
+// recordWebhook stores a first delivery of an event. A redelivery is counted
+// on the stored event, and taken over for processing only when the earlier
+// deliveries failed or were rejected; otherwise it is reported as a duplicate.
+func (s *DisbursementService) recordWebhook(ctx context.Context, delivery WebhookDelivery, payload WebhookPayload) (*models.WebhookEvent, bool, error) {
+	timeNow := time.Now()
+	event := models.WebhookEvent{
+		EventID:        payload.ID,
+		Event:          payload.Event,
+		SequenceID:     payload.SequenceID,
+		Headers:        delivery.Headers,
+		Body:           string(delivery.Body),
+		SignatureValid: delivery.SignatureValid,
+		Status:         models.WebhookEventReceived,
+		Deliveries:     1,
+		ReceivedAt:     &timeNow,
+		LastReceivedAt: &timeNow,
+	}
+	id, err := s.repos.WebhookEvent.Create(ctx, event)
+	if err == nil {
+		event.ID, _ = id.(primitive.ObjectID)
+		return &event, false, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, false, err
+	}
+
+	counted, err := s.repos.WebhookEvent.FindOneAndUpdate(ctx,
+		bson.D{{Key: "event_id", Value: payload.ID}},
+		bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "deliveries", Value: 1}}},
+			{Key: "$set", Value: bson.D{{Key: "last_received_at", Value: timeNow}}},
+		})
+	if err != nil {
+		return nil, false, err
+	}
+	if !lo.Contains([]string{models.WebhookEventFailed, models.WebhookEventRejected}, counted.Status) {
+		return counted, true, nil
+	}
+
+	claimed, err := s.repos.WebhookEvent.FindOneAndUpdate(ctx,
+		bson.D{
+			{Key: "_id", Value: counted.ID},
+			{Key: "status", Value: counted.Status},
+		},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: models.WebhookEventReceived},
+			{Key: "headers", Value: delivery.Headers},
+			{Key: "body", Value: event.Body},
+			{Key: "signature_valid", Value: delivery.SignatureValid},
+		}}})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// a concurrent redelivery took it over
+		return counted, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return claimed, false, nil
+}
+
+// settleWebhook records the outcome of processing the event.
+func (s *DisbursementService) settleWebhook(ctx context.Context, event *models.WebhookEvent, status string, err error) {
+	reason := ""
+	if err != nil {
+		reason = err.Error()
+	}
+	timeNow := time.Now()
+	updated, uerr := s.repos.WebhookEvent.FindOneAndUpdate(context.WithoutCancel(ctx),
+		bson.D{{Key: "_id", Value: event.ID}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: status},
+			{Key: "error", Value: reason},
+			{Key: "processed_at", Value: timeNow},
+		}}})
+	if uerr != nil {
+		s.logger.Errorf("could not record outcome of webhook event [%s]: %v", event.EventID, uerr)
+		return
+	}
+	*event = *updated
+}
+
+// WebhookEventFilter narrows down the events returned by ListWebhookEvents.
+type WebhookEventFilter struct {
+	EventID    string
+	SequenceID string
+	Statuses   []string
+	From, To   *time.Time
+}
+
+func (f WebhookEventFilter) query() bson.D {
+	query := bson.D{}
+	if f.EventID != "" {
+		query = append(query, bson.E{Key: "event_id", Value: f.EventID})
+	}
+	if f.SequenceID != "" {
+		query = append(query, bson.E{Key: "sequence_id", Value: f.SequenceID})
+	}
+	if len(f.Statuses) > 0 {
+		query = append(query, bson.E{Key: "status", Value: bson.D{{Key: "$in", Value: f.Statuses}}})
+	}
+
+	receivedAt := bson.D{}
+	if f.From != nil {
+		receivedAt = append(receivedAt, bson.E{Key: "$gte", Value: *f.From})
+	}
+	if f.To != nil {
+		receivedAt = append(receivedAt, bson.E{Key: "$lte", Value: *f.To})
+	}
+	if len(receivedAt) > 0 {
+		query = append(query, bson.E{Key: "received_at", Value: receivedAt})
+	}
+	return query
+}
+
+// ListWebhookEvents returns a page of the stored webhook events matching the filter.
+func (s *DisbursementService) ListWebhookEvents(ctx context.Context, filter WebhookEventFilter, page repository.PageQuery) (*repository.Page[models.WebhookEvent], error) {
+	page.Filter = filter.query()
+	return s.repos.WebhookEvent.FindPage(ctx, page)
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"testing"
+	"time"
+	"yc-backend/models"
+
+	"github.com/gookit/goutil/testutil/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestWebhookEventFilterQuery(t *testing.T) {
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	query := WebhookEventFilter{
+		SequenceID: "seq-1",
+		Statuses:   []string{models.WebhookEventFailed},
+		From:       &from,
+	}.query()
+
+	assert.Eq(t, bson.D{
+		{Key: "sequence_id", Value: "seq-1"},
+		{Key: "status", Value: bson.D{{Key: "$in", Value: []string{models.WebhookEventFailed}}}},
+		{Key: "received_at", Value: bson.D{{Key: "$gte", Value: from}}},
+	}, query)
+}
+
+func TestWebhookEventFilterWithoutConditionsMatchesEverything(t *testing.T) {
+	assert.Len(t, WebhookEventFilter{}.query(), 0)
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+	"yc-backend/models"
+
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// checkpoint marks the payroll work item of the disbursement submitted before
+// its payment is sent to Yellow Card.
+func (s *DisbursementService) checkpoint(ctx context.Context, disbursement *models.Disbursement) error {
+	if disbursement.PayrollRunID.IsZero() {
+		return nil
+	}
+	timeNow := time.Now()
+	_, err := s.repos.WorkItem.FindOneAndUpdate(ctx,
+		bson.D{
+			{Key: "disbursement_id", Value: disbursement.ID},
+			{Key: "status", Value: models.WorkItemPending},
+		},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: models.WorkItemSubmitted},
+			{Key: "updatedAt", Value: timeNow},
+		}}})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// already submitted once, or a retry, which has no work item
+		return nil
+	}
+	return err
+}
+
+// payWorkItem pays the employee of a work item and settles the item. A
+// disbursement created before the process stopped is resumed rather than paid
+// again. Work cut short by a shutdown is left unsettled for the next start.
+func (s *DisbursementService) payWorkItem(ctx context.Context, req DisbursementRequest, item models.PayrollWorkItem) error {
+	existing, err := s.repos.Disbursement.FindOneById(ctx, item.DisbursementID)
+	if err == nil {
+		resumed, err := s.resume(ctx, existing)
+		if resumed == nil {
+			return err
+		}
+		s.settleWorkItem(ctx, item, models.WorkItemConfirmed, "")
+		return err
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	req.ID, req.sequenceID = item.DisbursementID, item.SequenceID
+	disbursement, err := s.Disburse(ctx, req)
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	// failed submissions are tracked through the disbursement's status
+	if err != nil && disbursement == nil {
+		s.settleWorkItem(ctx, item, models.WorkItemFailed, err.Error())
+		return err
+	}
+	s.settleWorkItem(ctx, item, models.WorkItemConfirmed, "")
+	return err
+}
+
+func (s *DisbursementService) settleWorkItem(ctx context.Context, item models.PayrollWorkItem, status, reason string) {
+	timeNow := time.Now()
+	if err := s.repos.WorkItem.UpdateOneById(context.WithoutCancel(ctx), item.ID, models.PayrollWorkItem{
+		Status:    status,
+		Error:     reason,
+		UpdatedAt: &timeNow,
+	}); err != nil {
+		s.logger.Errorf("could not mark work item of employee [%s] %s: %v", item.EmployeeID.Hex(), status, err)
+	}
+}
+
+// finishPayrollRun records the failures of the run's work items and, once
+// every item is settled, the outcome of the run.
+func (s *DisbursementService) finishPayrollRun(ctx context.Context, run *models.PayrollRun) error {
+	items, err := s.repos.WorkItem.FindMany(ctx, bson.D{{Key: "run_id", Value: run.ID}})
+	if err != nil {
+		return err
+	}
+
+	failures := []models.PayrollRunFailure{}
+	unsettled := 0
+	for _, item := range items {
+		switch item.Status {
+		case models.WorkItemFailed:
+			failures = append(failures, models.PayrollRunFailure{EmployeeID: item.EmployeeID, Error: item.Error})
+		case models.WorkItemPending, models.WorkItemSubmitted:
+			unsettled++
+		}
+	}
+
+	timeNow := time.Now()
+	run.Failures = failures
+	run.UpdatedAt = &timeNow
+	if unsettled > 0 {
+		s.logger.Warningf("payroll run [%s] stopped with %d employees left, it resumes on the next start", run.ID.Hex(), unsettled)
+	} else {
+		run.Status = models.PayrollRunSubmitted
+		if len(failures) == len(items) {
+			run.Status = models.PayrollRunFailed
+		}
+		run.CompletedAt = &timeNow
+	}
+	return s.repos.PayrollRun.UpdateOneById(ctx, run.ID, *run)
+}
+
+// ResumePayrollRuns executes the payroll runs a previous process left running,
+// for the employees whose work items are not settled yet. Runs created after
+// it starts belong to this process and are left alone.
+func (s *DisbursementService) ResumePayrollRuns(ctx context.Context) {
+	runs, err := s.repos.PayrollRun.FindMany(ctx, bson.D{
+		{Key: "status", Value: models.PayrollRunRunning},
+		{Key: "createdAt", Value: bson.D{{Key: "$lt", Value: time.Now()}}},
+	})
+	if err != nil {
+		s.logger.Errorf("could not load interrupted payroll runs: %v", err)
+		return
+	}
+
+	for i := range runs {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.resumePayrollRun(ctx, &runs[i]); err != nil {
+			s.logger.Errorf("could not resume payroll run [%s]: %v", runs[i].ID.Hex(), err)
+		}
+	}
+}
+
+func (s *DisbursementService) resumePayrollRun(ctx context.Context, run *models.PayrollRun) error {
+	user, err := s.repos.User.FindOneById(ctx, run.UserID)
+	if err != nil {
+		return err
+	}
+	items, err := s.repos.WorkItem.FindMany(ctx, bson.D{
+		{Key: "run_id", Value: run.ID},
+		{Key: "status", Value: bson.D{{Key: "$in", Value: []string{models.WorkItemPending, models.WorkItemSubmitted}}}},
+	})
+	if err != nil {
+		return err
+	}
+	employeeIds := lo.Map(items, func(item models.PayrollWorkItem, _ int) primitive.ObjectID {
+		return item.EmployeeID
+	})
+	employees, err := s.repos.Employee.FindMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: employeeIds}}}})
+	if err != nil {
+		return err
+	}
+
+	found := lo.KeyBy(employees, func(employee models.Employee) primitive.ObjectID {
+		return employee.ID
+	})
+	for _, item := range items {
+		if _, ok := found[item.EmployeeID]; !ok {
+			s.settleWorkItem(ctx, item, models.WorkItemFailed, "employee no longer exists")
+		}
+	}
+
+	s.logger.Noticef("resuming payroll run [%s] for %d employees", run.ID.Hex(), len(employees))
+	s.ExecutePayrollRun(ctx, run, user, employees)
+	return nil
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yc-backend/internals"
+	"yc-backend/models"
+	"yc-backend/pkg"
+
+	"github.com/gookit/goutil/testutil/assert"
+)
+
+// newLookupService returns a service whose Yellow Card answers every payment
+// lookup with status, and counts the payments submitted to it.
+func newLookupService(t *testing.T, status int) (*DisbursementService, *int) {
+	submitted := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			submitted++
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"code": "error"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	return &DisbursementService{
+		client: pkg.NewYellowClient(server.URL, "key", "secret"),
+		logger: internals.GetLogger(),
+	}, &submitted
+}
+
+func TestResumeLeavesSubmittedDisbursementsAlone(t *testing.T) {
+	svc, submitted := newLookupService(t, http.StatusOK)
+	disbursement := &models.Disbursement{Status: models.DisbursementProcessing}
+
+	resumed, err := svc.resume(context.Background(), disbursement)
+
+	assert.NoError(t, err)
+	assert.Equal(t, disbursement, resumed)
+	assert.Equal(t, 0, *submitted)
+}
+
+func TestResumeDoesNotSubmitWhenLookupFails(t *testing.T) {
+	svc, submitted := newLookupService(t, http.StatusBadGateway)
+
+	resumed, err := svc.resume(context.Background(), &models.Disbursement{
+		Status:         models.DisbursementCreated,
+		PaymentRequest: &models.PaymentRequest{SequenceID: "reserved"},
+	})
+
+	assert.Err(t, err)
+	assert.Nil(t, resumed)
+	assert.Equal(t, 0, *submitted)
+}
+
+func TestLookupOfUnknownSequenceIDIsNotFound(t *testing.T) {
+	svc, _ := newLookupService(t, http.StatusNotFound)
+
+	_, err := svc.client.GetPaymentBySequenceID("reserved")
+
+	assert.ErrIs(t, err, pkg.ErrPaymentNotFound)
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"fmt"
 	"math/rand"
 	"time"
 )
@@ -42,3 +43,22 @@ func LoopOverMap[T comparable](data map[T]T, fn func(k, V T)) {
 		fn(k, v)
 	}
 }
+
+// ParseTime accepts either an RFC3339 timestamp or a plain date; a plain date
+// used as an upper bound covers the whole day.
+func ParseTime(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date [%s]", value)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t, nil
+}